@@ -0,0 +1,190 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/gensupport"
+	"google.golang.org/api/internal/third_party/uritemplates"
+	"google.golang.org/api/internal/version"
+)
+
+// Call is a single call of a method. Create one with Method.Call, set its
+// parameters and body, then send it with Do or DoInto.
+type Call struct {
+	m          *Method
+	pathParams map[string]string
+	urlParams  gensupport.URLParams
+	body       interface{}
+	ctx        context.Context
+	header     http.Header
+	err        error
+}
+
+// Call creates a new call of m.
+func (m *Method) Call() *Call {
+	return &Call{
+		m:          m,
+		pathParams: make(map[string]string),
+		urlParams:  make(gensupport.URLParams),
+	}
+}
+
+// Param sets the parameter name of the call to values, which are formatted
+// with fmt.Sprint. Path parameters take a single value, and query parameters
+// take one value unless they are repeated. Names that are not parameters of
+// the method are sent as query parameters, which allows the standard
+// parameters of the API, such as "quotaUser", to be set.
+func (c *Call) Param(name string, values ...interface{}) *Call {
+	p := c.m.Parameters[name]
+	if len(values) == 0 || (len(values) > 1 && (p == nil || !p.Repeated)) {
+		c.err = fmt.Errorf("dynamic: parameter %q of %s takes one value, got %d", name, c.m.ID, len(values))
+		return c
+	}
+	if p != nil && p.Location == "path" {
+		c.pathParams[name] = fmt.Sprint(values[0])
+		return c
+	}
+	var vs []string
+	for _, v := range values {
+		vs = append(vs, fmt.Sprint(v))
+	}
+	c.urlParams.SetMulti(name, vs)
+	return c
+}
+
+// Body sets the request body of the call to the JSON encoding of v.
+func (c *Call) Body(v interface{}) *Call {
+	c.body = v
+	return c
+}
+
+// Fields allows partial responses to be retrieved. See
+// https://developers.google.com/gdata/docs/2.0/basics#PartialResponse for
+// more information.
+func (c *Call) Fields(s ...googleapi.Field) *Call {
+	c.urlParams.Set("fields", googleapi.CombineFields(s))
+	return c
+}
+
+// Context sets the context to be used in this call's Do and DoInto methods.
+// Any pending HTTP request will be aborted if the provided context is
+// canceled.
+func (c *Call) Context(ctx context.Context) *Call {
+	c.ctx = ctx
+	return c
+}
+
+// Header returns an http.Header that can be modified by the caller to add
+// HTTP headers to the request.
+func (c *Call) Header() http.Header {
+	if c.header == nil {
+		c.header = make(http.Header)
+	}
+	return c.header
+}
+
+// Do sends the call and returns its response decoded into a map. It returns a
+// nil map if the method has no response body.
+func (c *Call) Do(opts ...googleapi.CallOption) (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	if err := c.DoInto(&ret, opts...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// DoInto sends the call and decodes its response into v, as with
+// json.Unmarshal. If v is nil or the method has no response body, the
+// response is discarded.
+func (c *Call) DoInto(v interface{}, opts ...googleapi.CallOption) error {
+	res, err := c.doRequest(opts)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	if v == nil || c.m.Response == "" {
+		return nil
+	}
+	if c.m.s.dataWrapper {
+		v = &struct {
+			Data interface{} `json:"data"`
+		}{v}
+	}
+	return gensupport.DecodeResponse(v, res)
+}
+
+// errNoService is returned by calls of a Method that was not obtained from a
+// Service.
+var errNoService = errors.New("dynamic: method does not belong to a Service")
+
+func (c *Call) doRequest(opts []googleapi.CallOption) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	s := c.m.s
+	if s == nil {
+		return nil, errNoService
+	}
+	var names []string
+	for name := range c.m.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !c.m.Parameters[name].Required {
+			continue
+		}
+		if _, ok := c.pathParams[name]; !ok && len(c.urlParams[name]) == 0 {
+			return nil, fmt.Errorf("dynamic: required parameter %q of %s is not set", name, c.m.ID)
+		}
+	}
+
+	reqHeaders := make(http.Header)
+	reqHeaders.Set("x-goog-api-client", "gl-go/"+gensupport.GoVersion()+" gdcl/"+version.Repo)
+	for k, v := range c.header {
+		reqHeaders[k] = v
+	}
+	reqHeaders.Set("User-Agent", s.userAgent())
+	var body io.Reader
+	if c.body != nil {
+		v := c.body
+		if s.dataWrapper {
+			v = map[string]interface{}{"data": v}
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+		reqHeaders.Set("Content-Type", "application/json")
+	}
+	gensupport.SetOptions(c.urlParams, opts...)
+	c.urlParams.Set("alt", "json")
+	c.urlParams.Set("prettyPrint", "false")
+	urls, _, err := uritemplates.Expand(googleapi.ResolveRelative(s.BasePath, c.m.Path), c.pathParams)
+	if err != nil {
+		return nil, err
+	}
+	urls += "?" + c.urlParams.Encode()
+	req, err := http.NewRequest(c.m.HTTPMethod, urls, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = reqHeaders
+	return gensupport.SendRequestWithRetryConfig(c.ctx, s.client, req, s.retry)
+}
@@ -0,0 +1,271 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dynamic calls Google APIs described by a discovery document that is
+// loaded at run time, without a generated package. It is meant for tools and
+// scripts that work with APIs, or versions of APIs, that have no generated
+// package, such as those served from a private discovery URL.
+//
+// Requests are sent with the same HTTP transport as the generated packages,
+// and accept the same client options:
+//
+//   svc, err := dynamic.NewServiceFromURL(ctx, "https://www.googleapis.com/discovery/v1/apis/drive/v3/rest")
+//   if err != nil {
+//     // TODO: handle error.
+//   }
+//   m, err := svc.Method("files.get")
+//   if err != nil {
+//     // TODO: handle error.
+//   }
+//   file, err := m.Call().Param("fileId", id).Fields("name", "size").Do()
+//
+// Responses are decoded into a map[string]interface{} by Call.Do, or into a
+// value of the caller's choosing by Call.DoInto.
+//
+// Media upload and download are not supported.
+package dynamic
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/disco"
+	"google.golang.org/api/internal/gensupport"
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Service is a client for the API described by a discovery document.
+type Service struct {
+	BasePath  string // API endpoint base URL
+	UserAgent string // optional additional User-Agent fragment
+
+	// ID is the ID of the API, such as "drive:v3".
+	ID string
+
+	// Resources holds the top-level resources of the API, by name.
+	Resources map[string]*Resource
+
+	// Methods holds the top-level methods of the API, by name.
+	Methods map[string]*Method
+
+	client      *http.Client
+	retry       *googleapi.RetryConfig
+	byID        map[string]*Method
+	dataWrapper bool // whether bodies are wrapped in {"data": ...}
+}
+
+// Resource is a resource of an API, which groups related methods.
+type Resource struct {
+	Name     string
+	FullName string // dot-separated names of the resource and its parents
+
+	// Resources holds the sub-resources of the resource, by name.
+	Resources map[string]*Resource
+
+	// Methods holds the methods of the resource, by name.
+	Methods map[string]*Method
+}
+
+// Method is a method of an API.
+type Method struct {
+	ID          string // such as "drive.files.get"
+	Name        string
+	HTTPMethod  string
+	Path        string // URI template, relative to the service's BasePath
+	Description string
+
+	// Parameters holds the parameters of the method, by name.
+	Parameters map[string]*Parameter
+
+	// ParameterOrder lists the names of the required parameters, in the order
+	// in which they are usually given.
+	ParameterOrder []string
+
+	// Request and Response are the names of the schemas of the request and
+	// response bodies, or "" if the method has no such body.
+	Request  string
+	Response string
+
+	s *Service
+}
+
+// Parameter is a parameter of a method.
+type Parameter struct {
+	Name        string
+	Location    string // "path" or "query"
+	Type        string // such as "string" or "integer"
+	Format      string // such as "int64"
+	Description string
+	Required    bool
+	Repeated    bool
+}
+
+// NewService creates a new Service for the API described by discoveryDoc, the
+// JSON discovery document of the API.
+func NewService(ctx context.Context, discoveryDoc []byte, opts ...option.ClientOption) (*Service, error) {
+	doc, err := disco.NewDocument(discoveryDoc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.RootURL == "" {
+		return nil, fmt.Errorf("dynamic: discovery document for %s has no rootUrl", doc.ID)
+	}
+	if len(doc.Auth.OAuth2Scopes) != 0 {
+		var scopes []string
+		for _, scope := range doc.Auth.OAuth2Scopes {
+			scopes = append(scopes, scope.ID)
+		}
+		// NOTE: prepend, so we don't override user-specified scopes.
+		opts = append([]option.ClientOption{option.WithScopes(scopes...)}, opts...)
+	}
+	opts = append(opts, internaloption.WithDefaultEndpoint(googleapi.ResolveRelative(doc.RootURL, doc.ServicePath)))
+	if doc.MTLSRootURL != "" {
+		opts = append(opts, internaloption.WithDefaultMTLSEndpoint(googleapi.ResolveRelative(doc.MTLSRootURL, doc.ServicePath)))
+	}
+	client, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{
+		BasePath:  googleapi.ResolveRelative(doc.RootURL, doc.ServicePath),
+		ID:        doc.ID,
+		Resources: make(map[string]*Resource),
+		Methods:   make(map[string]*Method),
+		client:    client,
+		retry:     gensupport.RetryConfigFromOptions(opts),
+		byID:      make(map[string]*Method),
+	}
+	if endpoint != "" {
+		s.BasePath = endpoint
+	}
+	for _, f := range doc.Features {
+		if f == "dataWrapper" {
+			s.dataWrapper = true
+		}
+	}
+	for _, m := range doc.Methods {
+		s.Methods[m.Name] = s.newMethod(m)
+	}
+	for _, r := range doc.Resources {
+		s.Resources[r.Name] = s.newResource(r)
+	}
+	return s, nil
+}
+
+// NewServiceFromURL fetches the discovery document at url with the default
+// HTTP client, and creates a new Service for the API it describes. To fetch
+// a document that requires authentication, read it with a suitable client and
+// pass it to NewService.
+func NewServiceFromURL(ctx context.Context, url string, opts ...option.ClientOption) (*Service, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	doc, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return NewService(ctx, doc, opts...)
+}
+
+func (s *Service) newResource(r *disco.Resource) *Resource {
+	res := &Resource{
+		Name:      r.Name,
+		FullName:  r.FullName,
+		Resources: make(map[string]*Resource),
+		Methods:   make(map[string]*Method),
+	}
+	for _, m := range r.Methods {
+		res.Methods[m.Name] = s.newMethod(m)
+	}
+	for _, sub := range r.Resources {
+		res.Resources[sub.Name] = s.newResource(sub)
+	}
+	return res
+}
+
+func (s *Service) newMethod(m *disco.Method) *Method {
+	meth := &Method{
+		ID:             m.ID,
+		Name:           m.Name,
+		HTTPMethod:     m.HTTPMethod,
+		Path:           m.Path,
+		Description:    m.Description,
+		Parameters:     make(map[string]*Parameter),
+		ParameterOrder: m.ParameterOrder,
+		Request:        schemaName(m.Request),
+		Response:       schemaName(m.Response),
+		s:              s,
+	}
+	for _, p := range m.Parameters {
+		meth.Parameters[p.Name] = &Parameter{
+			Name:        p.Name,
+			Location:    p.Location,
+			Type:        p.Type,
+			Format:      p.Format,
+			Description: p.Description,
+			Required:    p.Required,
+			Repeated:    p.Repeated,
+		}
+	}
+	s.byID[m.ID] = meth
+	return meth
+}
+
+// schemaName returns the name of the schema referred to by s, or "" if s is
+// nil.
+func schemaName(s *disco.Schema) string {
+	if s == nil {
+		return ""
+	}
+	if s.Ref != "" {
+		return s.Ref
+	}
+	return s.Name
+}
+
+// Method returns the method with the given name. The name is either the
+// method's ID, such as "drive.files.get", or its path from the top of the
+// API, such as "files.get" or "projects.locations.list".
+func (s *Service) Method(name string) (*Method, error) {
+	if m, ok := s.byID[name]; ok {
+		return m, nil
+	}
+	parts := strings.Split(name, ".")
+	methods := s.Methods
+	resources := s.Resources
+	for _, p := range parts[:len(parts)-1] {
+		r, ok := resources[p]
+		if !ok {
+			return nil, fmt.Errorf("dynamic: %s has no method %q", s.ID, name)
+		}
+		methods, resources = r.Methods, r.Resources
+	}
+	m, ok := methods[parts[len(parts)-1]]
+	if !ok {
+		return nil, fmt.Errorf("dynamic: %s has no method %q", s.ID, name)
+	}
+	return m, nil
+}
+
+func (s *Service) userAgent() string {
+	if s.UserAgent == "" {
+		return googleapi.UserAgent
+	}
+	return googleapi.UserAgent + " " + s.UserAgent
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const testDoc = `{
+ "id": "things:v1",
+ "name": "things",
+ "version": "v1",
+ "rootUrl": "https://things.googleapis.com/",
+ "servicePath": "",
+ "auth": {"oauth2": {"scopes": {"https://www.googleapis.com/auth/things": {"description": "Things"}}}},
+ "schemas": {
+  "Thing": {"id": "Thing", "type": "object", "properties": {"name": {"type": "string"}, "size": {"type": "string", "format": "int64"}}}
+ },
+ "resources": {
+  "projects": {
+   "resources": {
+    "things": {
+     "methods": {
+      "get": {
+       "id": "things.projects.things.get",
+       "path": "v1/{+name}",
+       "httpMethod": "GET",
+       "parameters": {
+        "name": {"type": "string", "required": true, "location": "path"},
+        "view": {"type": "string", "location": "query"}
+       },
+       "parameterOrder": ["name"],
+       "response": {"$ref": "Thing"}
+      },
+      "create": {
+       "id": "things.projects.things.create",
+       "path": "v1/{+parent}/things",
+       "httpMethod": "POST",
+       "parameters": {
+        "parent": {"type": "string", "required": true, "location": "path"},
+        "tags": {"type": "string", "repeated": true, "location": "query"}
+       },
+       "parameterOrder": ["parent"],
+       "request": {"$ref": "Thing"},
+       "response": {"$ref": "Thing"}
+      },
+      "delete": {
+       "id": "things.projects.things.delete",
+       "path": "v1/{+name}",
+       "httpMethod": "DELETE",
+       "parameters": {
+        "name": {"type": "string", "required": true, "location": "path"}
+       },
+       "parameterOrder": ["name"]
+      }
+     }
+    }
+   }
+  }
+ }
+}`
+
+// testRequest is the JSON body written by the test server.
+type testRequest struct {
+	Method, URI, Body, UA string
+}
+
+// newTestService returns a Service for testDoc whose requests are answered
+// by a test server, and a function that stops the server.
+func newTestService(t *testing.T) (*Service, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			return
+		}
+		if r.URL.Path == "/v1/projects/p/things/missing" {
+			http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(testRequest{r.Method, r.URL.RequestURI(), string(body), r.Header.Get("User-Agent")})
+	}))
+	s, err := NewService(context.Background(), []byte(testDoc), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return s, srv.Close
+}
+
+func TestMethod(t *testing.T) {
+	s, done := newTestService(t)
+	defer done()
+	for _, name := range []string{"projects.things.get", "things.projects.things.get"} {
+		m, err := s.Method(name)
+		if err != nil {
+			t.Fatalf("Method(%q): %v", name, err)
+		}
+		if m.ID != "things.projects.things.get" || m.Response != "Thing" || !m.Parameters["name"].Required {
+			t.Errorf("Method(%q) = %+v", name, m)
+		}
+	}
+	if m := s.Resources["projects"].Resources["things"].Methods["create"]; m.Request != "Thing" {
+		t.Errorf("create: got request %q, want Thing", m.Request)
+	}
+	for _, name := range []string{"projects.things.list", "projects.get", "get", "stuff.get"} {
+		if _, err := s.Method(name); err == nil {
+			t.Errorf("Method(%q): got nil, want error", name)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	s, done := newTestService(t)
+	defer done()
+	s.UserAgent = "test"
+	get, _ := s.Method("projects.things.get")
+	got, err := get.Call().Param("name", "projects/p/things/t").Param("view", "FULL").Fields("name").Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"Method": "GET",
+		"URI":    "/v1/projects/p/things/t?alt=json&fields=name&prettyPrint=false&view=FULL",
+		"Body":   "",
+		"UA":     googleapi.UserAgent + " test",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("get: got %v, want %v", got, want)
+	}
+
+	create, _ := s.Method("projects.things.create")
+	var req testRequest
+	err = create.Call().
+		Param("parent", "projects/p").
+		Param("tags", "a", "b").
+		Body(map[string]string{"name": "n"}).
+		Context(context.Background()).
+		DoInto(&req, googleapi.QuotaUser("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReq := testRequest{
+		Method: "POST",
+		URI:    "/v1/projects/p/things?alt=json&prettyPrint=false&quotaUser=u&tags=a&tags=b",
+		Body:   `{"name":"n"}`,
+		UA:     googleapi.UserAgent + " test",
+	}
+	if req != wantReq {
+		t.Errorf("create: got %+v, want %+v", req, wantReq)
+	}
+
+	del, _ := s.Method("projects.things.delete")
+	if got, err := del.Call().Param("name", "projects/p/things/t").Do(); err != nil || got != nil {
+		t.Errorf("delete: got %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	s, done := newTestService(t)
+	defer done()
+	get, _ := s.Method("projects.things.get")
+	if _, err := get.Call().Do(); err == nil {
+		t.Error("missing required parameter: got nil, want error")
+	}
+	if _, err := get.Call().Param("name", "a", "b").Do(); err == nil {
+		t.Error("several values for a path parameter: got nil, want error")
+	}
+	_, err := get.Call().Param("name", "projects/p/things/missing").Do()
+	if e, ok := err.(*googleapi.Error); !ok || e.Code != http.StatusNotFound {
+		t.Errorf("got error %v, want *googleapi.Error with code 404", err)
+	}
+}
+
+func TestCallDataWrapper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": testRequest{r.Method, r.URL.RequestURI(), string(body), ""},
+		})
+	}))
+	defer srv.Close()
+	doc := strings.Replace(testDoc, `"servicePath": "",`, `"servicePath": "", "features": ["dataWrapper"],`, 1)
+	s, err := NewService(context.Background(), []byte(doc), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	create, _ := s.Method("projects.things.create")
+	var req testRequest
+	if err := create.Call().Param("parent", "projects/p").Body(map[string]string{"name": "n"}).DoInto(&req); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":{"name":"n"}}`; req.Method != "POST" || req.Body != want {
+		t.Errorf("got %+v, want a POST with body %s", req, want)
+	}
+}
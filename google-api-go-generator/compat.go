@@ -0,0 +1,433 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The compat subcommand compares two revisions of a discovery document and
+// reports the changes to the generated package that could break code using
+// it, such as removed methods, fields whose type changed, and identifiers
+// renamed to avoid a name collision:
+//
+//	google-api-go-generator [flags] compat [-all] old-api.json new-api.json
+//
+// The flags before "compat" are those that affect code generation, such as
+// --typed_formats. It exits with status 1 if there are breaking changes.
+func compatMain(args []string) int {
+	fs := flag.NewFlagSet("compat", flag.ExitOnError)
+	all := fs.Bool("all", false, "Also report the changes that do not break existing code.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: google-api-go-generator [flags] compat [-all] old-api.json new-api.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	old, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	new, err := ioutil.ReadFile(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	changes, err := compareAPIs(old, new)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	n := writeCompatReport(os.Stdout, changes, *all)
+	if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+// A compatChange is a change to the exported API of a generated package.
+type compatChange struct {
+	breaking bool
+	msg      string
+}
+
+// breakingChangesError is returned by checkAndUpdateSpecFile with
+// --check_compat when the new revision of a discovery document has breaking
+// changes.
+type breakingChangesError struct {
+	changes []compatChange
+}
+
+func (e *breakingChangesError) Error() string {
+	var buf bytes.Buffer
+	n := writeCompatReport(&buf, e.changes, false)
+	return fmt.Sprintf("new revision has %d breaking change(s):\n%s", n, strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// checkCompat returns a *breakingChangesError if the code generated from the
+// discovery document new is not compatible with that generated from old.
+func checkCompat(old, new []byte) error {
+	changes, err := compareAPIs(old, new)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if c.breaking {
+			return &breakingChangesError{changes}
+		}
+	}
+	return nil
+}
+
+// writeCompatReport writes the breaking changes, then the other changes if
+// all is set, one per line. It returns the number of breaking changes.
+func writeCompatReport(w io.Writer, changes []compatChange, all bool) int {
+	n := 0
+	for _, c := range changes {
+		if c.breaking {
+			fmt.Fprintf(w, "%s\n", c.msg)
+			n++
+		}
+	}
+	if all {
+		for _, c := range changes {
+			if !c.breaking {
+				fmt.Fprintf(w, "%s\n", c.msg)
+			}
+		}
+	}
+	return n
+}
+
+// compareAPIs generates code from the discovery documents old and new and
+// returns the changes between their exported APIs.
+func compareAPIs(old, new []byte) ([]compatChange, error) {
+	oldSurface, err := surfaceOf(old)
+	if err != nil {
+		return nil, fmt.Errorf("old revision: %v", err)
+	}
+	newSurface, err := surfaceOf(new)
+	if err != nil {
+		return nil, fmt.Errorf("new revision: %v", err)
+	}
+	return compareSurfaces(oldSurface, newSurface), nil
+}
+
+// surfaceOf returns the exported API of the code generated from a discovery
+// document.
+func surfaceOf(jsonBytes []byte) (apiSurface, error) {
+	a, err := apiFromJSON(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.GenerateCode(); err != nil {
+		return nil, err
+	}
+	var files [][]byte
+	for _, f := range a.files {
+		files = append(files, f.code)
+	}
+	return parseSurface(files)
+}
+
+// A surfaceEntry is an exported declaration of a generated package.
+type surfaceEntry struct {
+	kind string // "type", "field", "method", "func", "const" or "var"
+	// decl is the declaration without its name, such as "struct" for a struct
+	// type, the type of a field, or the signature of a method.
+	decl     string
+	owner    string // for fields and methods, the name of their type
+	jsonName string // for fields, their JSON key
+}
+
+// An apiSurface maps the names of exported declarations, such as "Task",
+// "Task.Notes" or "(*TasksListCall).Do", to their entries.
+type apiSurface map[string]surfaceEntry
+
+// parseSurface returns the exported API of the Go source files of a package.
+func parseSurface(files [][]byte) (apiSurface, error) {
+	s := apiSurface{}
+	fset := token.NewFileSet()
+	str := func(n ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, n)
+		return buf.String()
+	}
+	for i, src := range files {
+		f, err := parser.ParseFile(fset, fmt.Sprintf("file%d.go", i), src, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() {
+					continue
+				}
+				sig := strings.TrimPrefix(str(d.Type), "func")
+				if d.Recv == nil {
+					s[d.Name.Name] = surfaceEntry{kind: "func", decl: sig}
+					continue
+				}
+				recv := d.Recv.List[0].Type
+				owner := recv
+				if star, ok := recv.(*ast.StarExpr); ok {
+					owner = star.X
+				}
+				id, ok := owner.(*ast.Ident)
+				if !ok || !id.IsExported() {
+					continue
+				}
+				s[fmt.Sprintf("(%s).%s", str(recv), d.Name.Name)] = surfaceEntry{kind: "method", decl: sig, owner: id.Name}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if spec.Name.IsExported() {
+							s.addType(spec, str)
+						}
+					case *ast.ValueSpec:
+						kind := "var"
+						if d.Tok == token.CONST {
+							kind = "const"
+						}
+						for j, name := range spec.Names {
+							if !name.IsExported() {
+								continue
+							}
+							var decl string
+							if spec.Type != nil {
+								decl = str(spec.Type)
+							}
+							if kind == "const" && j < len(spec.Values) {
+								decl = strings.TrimSpace(decl + " = " + str(spec.Values[j]))
+							}
+							s[name.Name] = surfaceEntry{kind: kind, decl: decl}
+						}
+					}
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// addType adds a type and its exported fields or interface methods to s.
+func (s apiSurface) addType(spec *ast.TypeSpec, str func(ast.Node) string) {
+	name := spec.Name.Name
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		s[name] = surfaceEntry{kind: "type", decl: "struct"}
+		for _, f := range t.Fields.List {
+			var jsonName string
+			if f.Tag != nil {
+				if tag, err := strconv.Unquote(f.Tag.Value); err == nil {
+					jsonName = strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]
+					if jsonName == "-" {
+						jsonName = ""
+					}
+				}
+			}
+			names := f.Names
+			if len(names) == 0 {
+				// An embedded field is named after its type.
+				typ := f.Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X
+				}
+				if sel, ok := typ.(*ast.SelectorExpr); ok {
+					typ = sel.Sel
+				}
+				if id, ok := typ.(*ast.Ident); ok {
+					names = []*ast.Ident{id}
+				}
+			}
+			for _, n := range names {
+				if n.IsExported() {
+					s[name+"."+n.Name] = surfaceEntry{kind: "field", decl: str(f.Type), owner: name, jsonName: jsonName}
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		s[name] = surfaceEntry{kind: "type", decl: "interface"}
+		for _, m := range t.Methods.List {
+			for _, n := range m.Names {
+				if n.IsExported() {
+					s[name+"."+n.Name] = surfaceEntry{kind: "method", decl: strings.TrimPrefix(str(m.Type), "func"), owner: name}
+				}
+			}
+		}
+	default:
+		decl := str(spec.Type)
+		if spec.Assign.IsValid() {
+			decl = "= " + decl
+		}
+		s[name] = surfaceEntry{kind: "type", decl: decl}
+	}
+}
+
+// collisionSuffixRE matches the suffix that namePool adds to a name that is
+// already taken.
+var collisionSuffixRE = regexp.MustCompile(`^\d+$`)
+
+// compareSurfaces returns the changes from old to new, sorted by the name of
+// the declaration they concern.
+func compareSurfaces(old, new apiSurface) []compatChange {
+	type named struct {
+		name string
+		compatChange
+	}
+	var changes []named
+	report := func(name string, breaking bool, format string, args ...interface{}) {
+		changes = append(changes, named{name, compatChange{breaking, fmt.Sprintf(format, args...)}})
+	}
+
+	// gone holds the old names whose declarations are no longer found under
+	// them, and added the new names that are not in old.
+	gone := map[string]bool{}
+	added := map[string]bool{}
+	for name, o := range old {
+		if n, ok := new[name]; !ok || n.kind != o.kind || n.decl != o.decl {
+			gone[name] = true
+		}
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			added[name] = true
+		}
+	}
+
+	// Find the declarations that were renamed, either by namePool because
+	// their name was taken by a new declaration, or for fields, because their
+	// JSON key now maps to a different Go name.
+	renamed := map[string]string{} // old type name to new
+	for _, name := range sortedNames(gone) {
+		o := old[name]
+		cands := renameCandidates(name, o, added, new)
+		if len(cands) == 0 {
+			continue
+		}
+		to := cands[0]
+		delete(gone, name)
+		delete(added, to)
+		if o.kind == "type" {
+			renamed[name] = to
+		}
+		if n, ok := new[name]; ok {
+			report(name, true, "renamed %s %s to %s; %s is now %s", o.kind, name, to, name, describe(name, n))
+		} else {
+			report(name, true, "renamed %s %s to %s", o.kind, name, to)
+		}
+	}
+
+	for name := range gone {
+		o := old[name]
+		if _, ok := renamed[o.owner]; ok {
+			// Reported with its type.
+			continue
+		}
+		if gone[o.owner] && new[o.owner].kind == "" {
+			// The type was removed, which is reported by itself.
+			continue
+		}
+		n, ok := new[name]
+		switch {
+		case !ok:
+			report(name, true, "removed %s", describe(name, o))
+		case n.kind != o.kind:
+			report(name, true, "changed %s from %s to %s", name, describe(name, o), describe(name, n))
+		default:
+			report(name, true, "changed %s %s: %s -> %s", o.kind, name, o.decl, n.decl)
+		}
+	}
+	for name := range added {
+		n := new[name]
+		if _, ok := added[n.owner]; ok {
+			// Reported with its type.
+			continue
+		}
+		isRenamed := false
+		for _, to := range renamed {
+			if to == n.owner {
+				isRenamed = true
+			}
+		}
+		if isRenamed {
+			continue
+		}
+		report(name, false, "added %s", describe(name, n))
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].name != changes[j].name {
+			return changes[i].name < changes[j].name
+		}
+		return changes[i].msg < changes[j].msg
+	})
+	var result []compatChange
+	for _, c := range changes {
+		result = append(result, c.compatChange)
+	}
+	return result
+}
+
+// renameCandidates returns the added names of new that o, the old
+// declaration called name, may have been renamed to.
+func renameCandidates(name string, o surfaceEntry, added map[string]bool, new apiSurface) []string {
+	var cands []string
+	for _, a := range sortedNames(added) {
+		n := new[a]
+		if n.kind != o.kind || n.owner != o.owner {
+			continue
+		}
+		if o.kind == "field" && o.jsonName != "" && n.jsonName == o.jsonName {
+			cands = append(cands, a)
+			continue
+		}
+		if n.decl == o.decl && strings.HasPrefix(a, name) && collisionSuffixRE.MatchString(a[len(name):]) {
+			cands = append(cands, a)
+		}
+	}
+	return cands
+}
+
+// describe returns a description of the declaration e called name, such as
+// "field Task.Notes string" or "method (*TasksService).Get(taskid string) *TasksGetCall".
+func describe(name string, e surfaceEntry) string {
+	switch {
+	case e.kind == "func" || e.kind == "method":
+		return fmt.Sprintf("%s %s%s", e.kind, name, e.decl)
+	case e.decl == "":
+		return fmt.Sprintf("%s %s", e.kind, name)
+	}
+	return fmt.Sprintf("%s %s %s", e.kind, name, e.decl)
+}
+
+func sortedNames(m map[string]bool) []string {
+	var names []string
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareSurfaces(t *testing.T) {
+	old, err := parseSurface([][]byte{[]byte(`package p
+
+type Task struct {
+	Notes    string ` + "`json:\"notes,omitempty\"`" + `
+	Position string ` + "`json:\"position,omitempty\"`" + `
+	Title    string ` + "`json:\"title,omitempty\"`" + `
+}
+
+type TaskStatus string
+
+const TaskStatusDone TaskStatus = "DONE"
+
+type TasksClearCall struct{}
+
+func (c *TasksClearCall) Do() error { return nil }
+
+type TasksService struct{}
+
+func (r *TasksService) Clear(tasklist string) *TasksClearCall { return nil }
+
+func (r *TasksService) Get(tasklist, task string) *TasksGetCall { return nil }
+
+type TasksGetCall struct{}
+`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := parseSurface([][]byte{[]byte(`package p
+
+type Task struct {
+	Due      string ` + "`json:\"due,omitempty\"`" + `
+	Notes1   string ` + "`json:\"notes,omitempty\"`" + `
+	Position int64  ` + "`json:\"position,omitempty,string\"`" + `
+	Title    string ` + "`json:\"title,omitempty\"`" + `
+}
+
+type TaskStatus struct{}
+
+type TaskStatus1 string
+
+const TaskStatusDone TaskStatus1 = "DONE"
+
+type TasksService struct{}
+
+func (r *TasksService) Get(tasklist, task string) *TasksGetCall { return nil }
+
+type TasksGetCall struct{}
+
+func (c *TasksGetCall) Fields() *TasksGetCall { return c }
+`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	n := writeCompatReport(&got, compareSurfaces(old, new), true)
+	want := `removed method (*TasksService).Clear(tasklist string) *TasksClearCall
+renamed field Task.Notes to Task.Notes1
+changed field Task.Position: string -> int64
+renamed type TaskStatus to TaskStatus1; TaskStatus is now type TaskStatus struct
+changed const TaskStatusDone: TaskStatus = "DONE" -> TaskStatus1 = "DONE"
+removed type TasksClearCall struct
+added method (*TasksGetCall).Fields() *TasksGetCall
+added field Task.Due string
+`
+	if got.String() != want {
+		t.Errorf("got report\n%s\nwant\n%s", got.String(), want)
+	}
+	if n != 6 {
+		t.Errorf("got %d breaking changes, want 6", n)
+	}
+}
+
+func TestCompareAPIs(t *testing.T) {
+	old, err := ioutil.ReadFile(filepath.Join("testdata", "blogger-3.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := compareAPIs(old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("comparing a document to itself: got %d changes, want none", len(changes))
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(old, &doc); err != nil {
+		t.Fatal(err)
+	}
+	resources := doc["resources"].(map[string]interface{})
+	delete(resources["blogs"].(map[string]interface{})["methods"].(map[string]interface{}), "listByUser")
+	blog := doc["schemas"].(map[string]interface{})["Blog"].(map[string]interface{})
+	blog["properties"].(map[string]interface{})["id"] = map[string]interface{}{"type": "string", "format": "int64"}
+	new, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCompat(old, new); err == nil {
+		t.Fatal("checkCompat: got nil, want error")
+	} else if _, ok := err.(*breakingChangesError); !ok {
+		t.Fatalf("checkCompat: got %v, want *breakingChangesError", err)
+	}
+	changes, err = compareAPIs(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	writeCompatReport(&got, changes, false)
+	for _, want := range []string{
+		"changed field Blog.Id: string -> int64",
+		"removed method (*BlogsService).ListByUser(",
+		"removed type BlogsListByUserCall",
+	} {
+		if !strings.Contains(got.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, got.String())
+		}
+	}
+	if err := checkCompat(new, new); err != nil {
+		t.Errorf("checkCompat of identical documents: %v", err)
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"go/ast"
 	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
 	"io"
 	"io/ioutil"
 	"log"
@@ -25,8 +29,9 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
-	"google.golang.org/api/google-api-go-generator/internal/disco"
+	"google.golang.org/api/internal/disco"
 	"google.golang.org/api/internal/version"
 )
 
@@ -44,17 +49,23 @@ var (
 
 	publicOnly = flag.Bool("publiconly", true, "Only build public, released APIs. Only applicable for Google employees.")
 
-	jsonFile       = flag.String("api_json_file", "", "If non-empty, the path to a local file on disk containing the API to generate. Exclusive with setting --api.")
-	output         = flag.String("output", "", "(optional) Path to source output file. If not specified, the API name and version are used to construct an output path (e.g. tasks/v1).")
-	apiPackageBase = flag.String("api_pkg_base", "google.golang.org/api", "Go package prefix to use for all generated APIs.")
-	baseURL        = flag.String("base_url", "", "(optional) Override the default service API URL. If empty, the service's root URL will be used.")
-	headerPath     = flag.String("header_path", "", "If non-empty, prepend the contents of this file to generated services.")
+	jsonFile        = flag.String("api_json_file", "", "If non-empty, the path to a local file on disk containing the API to generate. Exclusive with setting --api.")
+	output          = flag.String("output", "", "(optional) Path to source output file. If not specified, the API name and version are used to construct an output path (e.g. tasks/v1).")
+	apiPackageBase  = flag.String("api_pkg_base", "google.golang.org/api", "Go package prefix to use for all generated APIs.")
+	baseURL         = flag.String("base_url", "", "(optional) Override the default service API URL. If empty, the service's root URL will be used.")
+	headerPath      = flag.String("header_path", "", "If non-empty, prepend the contents of this file to generated services.")
+	typedFormats    = flag.String("typed_formats", "", "Comma-separated list of API IDs (like 'tasks:v1'), or '*' for all, whose google-datetime, google-duration and google-fieldmask fields are generated as time.Time, time.Duration and googleapi.FieldMask.")
+	allowlist       = flag.String("methods", "", "Comma-separated list of the method IDs (like 'tasks.tasks.list') and resource IDs (like 'tasks.tasks', selecting all methods of the resource and its sub-resources) to generate. APIs with no entries in the list are generated in full. Only the schemas used by the selected methods are generated.")
+	split           = flag.Bool("split", false, "Write each generated package as several files: one for the service, one for the schemas and one for the calls of each top-level resource.")
+	interfaces      = flag.String("interfaces", "", "Comma-separated list of API IDs (like 'tasks:v1'), or '*' for all, for which to generate interfaces of the resource services and calls, so that code using them can be tested with fakes.")
+	checkCompatFlag = flag.Bool("check_compat", false, "Don't update an API whose new discovery document has changes that break code using its generated package, as reported by the compat subcommand.")
 
 	gensupportPkg     = flag.String("gensupport_pkg", "google.golang.org/api/internal/gensupport", "Go package path of the 'api/internal/gensupport' support package.")
 	googleapiPkg      = flag.String("googleapi_pkg", "google.golang.org/api/googleapi", "Go package path of the 'api/googleapi' support package.")
 	optionPkg         = flag.String("option_pkg", "google.golang.org/api/option", "Go package path of the 'api/option' support package.")
 	internalOptionPkg = flag.String("internaloption_pkg", "google.golang.org/api/option/internaloption", "Go package path of the 'api/option/internaloption' support package.")
 	htransportPkg     = flag.String("htransport_pkg", "google.golang.org/api/transport/http", "Go package path of the 'api/transport/http' support package.")
+	iteratorPkg       = flag.String("iterator_pkg", "google.golang.org/api/iterator", "Go package path of the 'api/iterator' support package.")
 
 	copyrightYear = flag.String("copyright_year", fmt.Sprintf("%d", time.Now().Year()), "Year for copyright.")
 
@@ -87,11 +98,57 @@ type API struct {
 	usedNames     namePool
 	schemas       map[string]*Schema // apiName -> schema
 	responseTypes map[string]bool
+	batchType     string            // name of the generated Batch type, if the API supports batching
+	ops           *operationSupport // how to wait for long-running operations, if supported
+	enums         []*enumType       // enums of schemas, written after all schemas
+	ctors         []*Schema         // schemas with required fields, whose constructors are written after all schemas
+	files         []*genFile        // the files of the package; only the first unless --split
+	fileNames     namePool          // names of files other than the first, with --split
+	w             *bytes.Buffer     // where p and pn print
 
 	p  func(format string, args ...interface{}) // print raw
 	pn func(format string, args ...interface{}) // print with newline
 }
 
+// genFile is a file of a generated package. Unless --split is set, the
+// package has a single file.
+type genFile struct {
+	key  string // the key passed to beginFile; empty for the first file
+	name string // inserted in the file name, such as "schemas"; empty for the first file
+	buf  bytes.Buffer
+	code []byte // the formatted code of the file, once generated
+}
+
+// beginFile makes p and pn print to the file of the package with the given
+// key when generating with --split. If there is no such file, it is created
+// with a name based on name. The first file, which has the empty key, holds
+// the service and everything not put into another file.
+func (a *API) beginFile(key, name string) {
+	if !*split {
+		return
+	}
+	for _, f := range a.files {
+		if f.key == key {
+			a.w = &f.buf
+			return
+		}
+	}
+	f := &genFile{key: key, name: a.fileNames.Get(strings.ToLower(name))}
+	a.files = append(a.files, f)
+	a.w = &f.buf
+}
+
+// fileName returns the name of the file f of a package whose first file is
+// named mainFile.
+func (f *genFile) fileName(mainFile string) string {
+	if f.name == "" {
+		return mainFile
+	}
+	base := strings.TrimSuffix(mainFile, ".go")
+	base = strings.TrimSuffix(base, "-gen")
+	return base + "-" + f.name + "-gen.go"
+}
+
 func (a *API) sortedSchemaNames() (names []string) {
 	for name := range a.schemas {
 		names = append(names, name)
@@ -130,6 +187,10 @@ var skipAPIGeneration = map[string]bool{
 func main() {
 	flag.Parse()
 
+	if flag.Arg(0) == "compat" {
+		os.Exit(compatMain(flag.Args()[1:]))
+	}
+
 	if *install {
 		*build = true
 	}
@@ -279,10 +340,19 @@ func apiFromFile(file string) (*API, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error reading %s: %v", file, err)
 	}
-	doc, err := disco.NewDocument(jsonBytes)
+	a, err := apiFromJSON(jsonBytes)
 	if err != nil {
 		return nil, fmt.Errorf("reading document from %q: %v", file, err)
 	}
+	return a, nil
+}
+
+// apiFromJSON returns the API described by a discovery document.
+func apiFromJSON(jsonBytes []byte) (*API, error) {
+	doc, err := disco.NewDocument(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
 	a := &API{
 		ID:        doc.ID,
 		Name:      doc.Name,
@@ -305,6 +375,11 @@ func checkAndUpdateSpecFile(file string, contents []byte) error {
 	if err := isNewerRevision(existing, contents); err != nil {
 		return err
 	}
+	if *checkCompatFlag {
+		if err := checkCompat(existing, contents); err != nil {
+			return err
+		}
+	}
 	return writeFile(file, contents)
 }
 
@@ -454,6 +529,30 @@ func (a *API) Target() string {
 	return fmt.Sprintf("%s/%s/%s", *apiPackageBase, a.Package(), renameVersion(a.Version))
 }
 
+// useTypedFormats reports whether a was selected with --typed_formats to use
+// richer Go types for fields in the google-datetime, google-duration and
+// google-fieldmask formats.
+func (a *API) useTypedFormats() bool {
+	return apiSelected(*typedFormats, a.ID)
+}
+
+// useInterfaces reports whether a was selected with --interfaces to have
+// interfaces generated for its resource services and calls.
+func (a *API) useInterfaces() bool {
+	return apiSelected(*interfaces, a.ID)
+}
+
+// apiSelected reports whether the comma-separated list of API IDs in list
+// contains id or "*".
+func apiSelected(list, id string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if v == "*" || v == id {
+			return true
+		}
+	}
+	return false
+}
+
 // ServiceType returns the name of the type to use for the root API struct
 // (typically "Service").
 func (a *API) ServiceType() string {
@@ -483,16 +582,20 @@ func (a *API) GetName(preferred string) string {
 }
 
 func (a *API) apiBaseURL() string {
-	var base, rel string
+	return resolveRelative(a.apiRootURL())
+}
+
+// apiRootURL returns the root URL of the API and the path of the service
+// relative to it.
+func (a *API) apiRootURL() (root, servicePath string) {
 	switch {
 	case *baseURL != "":
-		base, rel = *baseURL, a.doc.BasePath
+		return *baseURL, a.doc.BasePath
 	case a.doc.RootURL != "":
-		base, rel = a.doc.RootURL, a.doc.ServicePath
+		return a.doc.RootURL, a.doc.ServicePath
 	default:
-		base, rel = *apisURL, a.doc.BasePath
+		return *apisURL, a.doc.BasePath
 	}
-	return resolveRelative(base, rel)
 }
 
 func (a *API) mtlsAPIBaseURL() string {
@@ -582,11 +685,118 @@ func (a *API) WriteGeneratedCode() error {
 	if err != nil {
 		return err
 	}
+	for _, f := range a.files[1:] {
+		if err := writeFile(f.fileName(genfilename), f.code); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 var docsLink string
 
+// applyAllowlist removes from a's discovery document the methods and
+// resources not selected with --methods, if any are selected for a, then the
+// schemas that can no longer be reached from the remaining methods. It
+// returns an error if an entry of --methods for a matches nothing.
+func (a *API) applyAllowlist() error {
+	prefix := a.doc.Name + "."
+	entries := map[string]bool{} // selected method and resource IDs; true once matched
+	for _, e := range strings.Split(*allowlist, ",") {
+		if strings.HasPrefix(e, prefix) {
+			entries[e] = false
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	keepMethods := func(meths disco.MethodList, all bool) disco.MethodList {
+		var kept disco.MethodList
+		for _, m := range meths {
+			if _, ok := entries[m.ID]; ok || all {
+				entries[m.ID] = true
+				kept = append(kept, m)
+			}
+		}
+		return kept
+	}
+	var keepResources func(rs disco.ResourceList, all bool) disco.ResourceList
+	keepResources = func(rs disco.ResourceList, all bool) disco.ResourceList {
+		var kept disco.ResourceList
+		for _, r := range rs {
+			id := a.doc.Name + r.FullName
+			rall := all
+			if _, ok := entries[id]; ok {
+				entries[id] = true
+				rall = true
+			}
+			r.Methods = keepMethods(r.Methods, rall)
+			r.Resources = keepResources(r.Resources, rall)
+			if len(r.Methods) > 0 || len(r.Resources) > 0 {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	}
+	a.doc.Methods = keepMethods(a.doc.Methods, false)
+	a.doc.Resources = keepResources(a.doc.Resources, false)
+
+	var unmatched []string
+	for e, matched := range entries {
+		if !matched {
+			unmatched = append(unmatched, e)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return fmt.Errorf("--methods: %s has no methods or resources %s", a.ID, strings.Join(unmatched, ", "))
+	}
+
+	reached := map[string]bool{}
+	var reach func(s *disco.Schema)
+	reach = func(s *disco.Schema) {
+		if s == nil {
+			return
+		}
+		if s.Ref != "" {
+			if reached[s.Ref] {
+				return
+			}
+			reached[s.Ref] = true
+			reach(a.doc.Schemas[s.Ref])
+			return
+		}
+		for _, p := range s.Properties {
+			reach(p.Schema)
+		}
+		reach(s.ItemSchema)
+		reach(s.AdditionalProperties)
+		if s.Variant != nil {
+			for _, v := range s.Variant.Map {
+				reach(&disco.Schema{Ref: v.Ref})
+			}
+		}
+	}
+	var walk func(meths disco.MethodList, rs disco.ResourceList)
+	walk = func(meths disco.MethodList, rs disco.ResourceList) {
+		for _, m := range meths {
+			reach(m.Request)
+			reach(m.Response)
+		}
+		for _, r := range rs {
+			walk(r.Methods, r.Resources)
+		}
+	}
+	walk(a.doc.Methods, a.doc.Resources)
+	for name := range a.doc.Schemas {
+		if !reached[name] {
+			delete(a.doc.Schemas, name)
+		}
+	}
+	return nil
+}
+
 func (a *API) GenerateCode() ([]byte, error) {
 	pkg := a.Package()
 
@@ -598,11 +808,16 @@ func (a *API) GenerateCode() ([]byte, error) {
 			return nil, err
 		}
 	}
+	if err := a.applyAllowlist(); err != nil {
+		return nil, err
+	}
 
 	// Buffer the output in memory, for gofmt'ing later.
-	var buf bytes.Buffer
+	a.files = []*genFile{{}}
+	buf := &a.files[0].buf
+	a.w = buf
 	a.p = func(format string, args ...interface{}) {
-		_, err := fmt.Fprintf(&buf, format, args...)
+		_, err := fmt.Fprintf(a.w, format, args...)
 		if err != nil {
 			panic(err)
 		}
@@ -617,7 +832,7 @@ func (a *API) GenerateCode() ([]byte, error) {
 		}
 		defer f.Close()
 
-		_, err = io.Copy(&buf, f)
+		_, err = io.Copy(buf, f)
 		return err
 	}
 
@@ -635,6 +850,8 @@ func (a *API) GenerateCode() ([]byte, error) {
 
 // Code generated file. DO NOT EDIT.
 `, *copyrightYear)
+	// The other files of the package get the same copyright and imports.
+	fileHeader := append([]byte{}, buf.Bytes()...)
 
 	pn("// Package %s provides access to the %s.", pkg, a.doc.Title)
 	if r := replacementPackage.Get(pkg, a.Version); r != "" {
@@ -681,8 +898,13 @@ func (a *API) GenerateCode() ([]byte, error) {
 	pn("//   %sService, err := %s.NewService(ctx, option.WithTokenSource(config.TokenSource(ctx, token)))", pkg, pkg)
 	pn("//")
 	pn("// See https://godoc.org/google.golang.org/api/option/ for details on options.")
+	if r := shutDownPackage.Get(pkg, a.Version); r != "" {
+		pn("//")
+		pn("// Deprecated: %s", r)
+	}
 	pn("package %s // import %q", pkg, a.Target())
 	p("\n")
+	importsStart := buf.Len()
 	pn("import (")
 	for _, imp := range []string{
 		"bytes",
@@ -698,6 +920,9 @@ func (a *API) GenerateCode() ([]byte, error) {
 	} {
 		pn("  %q", imp)
 	}
+	if a.useTypedFormats() {
+		pn("  %q", "time")
+	}
 	pn("")
 	for _, imp := range []struct {
 		pkg   string
@@ -708,6 +933,7 @@ func (a *API) GenerateCode() ([]byte, error) {
 		{*optionPkg, "option"},
 		{*internalOptionPkg, "internaloption"},
 		{*htransportPkg, "htransport"},
+		{*iteratorPkg, "iterator"},
 	} {
 		pn("  %s %q", imp.lname, imp.pkg)
 	}
@@ -726,6 +952,13 @@ func (a *API) GenerateCode() ([]byte, error) {
 	pn("var _ = strings.Replace")
 	pn("var _ = context.Canceled")
 	pn("var _ = internaloption.WithDefaultEndpoint")
+	pn("var _ = iterator.Done")
+	if a.useTypedFormats() {
+		pn("var _ = time.Now")
+	}
+	fileHeader = append(fileHeader, fmt.Sprintf("package %s\n\n", pkg)...)
+	fileHeader = append(fileHeader, buf.Bytes()[importsStart:]...)
+	fileHeader = append(fileHeader, "var _ = http.NewRequest\nvar _ = option.WithEndpoint\nvar _ = htransport.NewClient\n"...)
 	pn("")
 	pn("const apiId = %q", a.doc.ID)
 	pn("const apiName = %q", a.doc.Name)
@@ -734,6 +967,11 @@ func (a *API) GenerateCode() ([]byte, error) {
 	if mtlsBase := a.mtlsAPIBaseURL(); mtlsBase != "" {
 		pn("const mtlsBasePath = %q", mtlsBase)
 	}
+	if a.supportsBatch() {
+		_, servicePath := a.apiRootURL()
+		pn("const servicePath = %q", servicePath)
+		pn("const batchPath = %q", a.doc.BatchPath)
+	}
 
 	a.generateScopeConstants()
 	a.PopulateSchemas()
@@ -764,6 +1002,7 @@ func (a *API) GenerateCode() ([]byte, error) {
 	pn("s, err := New(client)")
 	pn("if err != nil { return nil, err }")
 	pn(`if endpoint != "" { s.BasePath = endpoint }`)
+	pn("s.retry = gensupport.RetryConfigFromOptions(opts)")
 	pn("return s, nil")
 	pn("}\n")
 
@@ -778,6 +1017,11 @@ func (a *API) GenerateCode() ([]byte, error) {
 	for _, res := range a.doc.Resources { // add top level resources.
 		pn("s.%s = New%s(s)", resourceGoField(res, nil), resourceGoType(res))
 	}
+	if a.useInterfaces() {
+		for _, res := range a.doc.Resources {
+			pn("s.%sAPI = %s{s.%s}", resourceGoField(res, nil), unexportedName(resourceAPIType(res)), resourceGoField(res, nil))
+		}
+	}
 	pn("return s, nil")
 	pn("}")
 
@@ -785,10 +1029,18 @@ func (a *API) GenerateCode() ([]byte, error) {
 	pn(" client *http.Client")
 	pn(" BasePath string // API endpoint base URL")
 	pn(" UserAgent string // optional additional User-Agent fragment")
+	pn(" retry *googleapi.RetryConfig // set with option.WithRetryConfig")
 
 	for _, res := range a.doc.Resources {
 		pn("\n\t%s\t*%s", resourceGoField(res, nil), resourceGoType(res))
 	}
+	if a.useInterfaces() {
+		for _, res := range a.doc.Resources {
+			f := resourceGoField(res, nil)
+			pn("\n\t// %sAPI is %s as a %s. It may be replaced with a fake in tests.", f, f, resourceAPIType(res))
+			pn("\t%sAPI\t%s", f, resourceAPIType(res))
+		}
+	}
 	pn("}")
 	pn("\nfunc (s *%s) userAgent() string {", service)
 	pn(` if s.UserAgent == "" { return googleapi.UserAgent }`)
@@ -807,25 +1059,510 @@ func (a *API) GenerateCode() ([]byte, error) {
 		a.cacheResourceResponseTypes(res)
 	}
 
+	a.beginFile("schemas", "schemas")
 	for _, name := range a.sortedSchemaNames() {
 		a.schemas[name].writeSchemaCode(a)
 	}
+	// Named after the schemas, so that schemas keep their names.
+	for _, e := range a.enums {
+		a.writeEnum(e)
+	}
+	a.reserveConstructorNames()
+	for _, s := range a.ctors {
+		s.writeConstructor()
+	}
+	a.beginFile("", "")
+
+	if a.supportsBatch() {
+		// Named after the schemas, so that a schema called "Batch" keeps its name.
+		a.batchType = a.GetName("Batch")
+	}
+
+	if a.ops = a.findOperationSupport(); a.ops != nil {
+		a.ops.waiter = a.GetName("OperationWaiter")
+	}
+
+	a.generateResourceNames()
 
 	for _, meth := range a.APIMethods() {
 		meth.generateCode()
 	}
 
 	for _, res := range a.doc.Resources {
+		a.beginFile("resource "+res.Name, res.Name)
 		a.generateResourceMethods(res)
 	}
+	a.beginFile("", "")
+
+	if a.supportsBatch() {
+		a.generateBatch()
+	}
+	if a.ops != nil {
+		a.generateOperationWaiter()
+	}
+	if a.useInterfaces() {
+		var src bytes.Buffer
+		for _, f := range a.files {
+			src.Write(f.buf.Bytes())
+		}
+		if err := a.generateInterfaces(src.Bytes()); err != nil {
+			return buf.Bytes(), err
+		}
+	}
 
+	for _, f := range a.files[1:] {
+		code := append(append([]byte{}, fileHeader...), f.buf.Bytes()...)
+		if f.code, err = format.Source(code); err != nil {
+			return code, err
+		}
+	}
 	clean, err := format.Source(buf.Bytes())
 	if err != nil {
 		return buf.Bytes(), err
 	}
+	a.files[0].code = clean
 	return clean, nil
 }
 
+// supportsBatch reports whether the API has a batch endpoint.
+func (a *API) supportsBatch() bool {
+	return a.doc.BatchPath != ""
+}
+
+// generateBatch writes the type used to send several calls in a single
+// multipart/mixed request to the API's batch endpoint.
+func (a *API) generateBatch() {
+	pn := a.pn
+	service := a.ServiceType()
+	bt := a.batchType
+
+	pn("\n// %s sends several calls to the API in a single HTTP request.", bt)
+	pn("// Create one with %s.NewBatch, add calls to it with their %s methods,", service, bt)
+	pn("// then send them with Do. Each call's callback is invoked with the")
+	pn("// results its Do method would have returned.")
+	pn("type %s struct {", bt)
+	pn(" s *%s", service)
+	pn(" b *gensupport.Batch")
+	pn("}")
+
+	pn("\n// NewBatch returns an empty %s that sends calls to the API's batch endpoint.", bt)
+	pn("func (s *%s) NewBatch() *%s {", service, bt)
+	pn(" return &%s{", bt)
+	pn("  s: s,")
+	pn("  b: &gensupport.Batch{")
+	pn("   Client: s.client,")
+	pn("   URL: gensupport.BatchURL(s.BasePath, servicePath, batchPath),")
+	pn("  },")
+	pn(" }")
+	pn("}")
+
+	pn("\n// Len returns the number of calls added to b.")
+	pn("func (b *%s) Len() int {", bt)
+	pn(" return b.b.Len()")
+	pn("}")
+
+	pn("\n// Do sends all the calls added to b in a single HTTP request, and returns")
+	pn("// once every call's callback has returned. It returns a non-nil error")
+	pn("// only if the batch request itself fails, in which case every call also")
+	pn("// fails. Errors from individual calls, such as a *googleapi.Error for a")
+	pn("// missing resource, are passed to their callbacks only.")
+	pn("// A %s may only be sent once.", bt)
+	pn("func (b *%s) Do(ctx context.Context) error {", bt)
+	pn(`reqHeaders := make(http.Header)`)
+	pn(`reqHeaders.Set("x-goog-api-client", "gl-go/"+gensupport.GoVersion()+" gdcl/%s")`, version.Repo)
+	pn(`reqHeaders.Set("User-Agent", b.s.userAgent())`)
+	pn(" b.b.Header = reqHeaders")
+	pn(" return b.b.Do(ctx)")
+	pn("}")
+}
+
+// operationSupport describes the long-running operations returned by the
+// methods of an API, for generating an OperationWaiter.
+type operationSupport struct {
+	schema *Schema
+	// compute is true for Compute Engine style operations, which have a
+	// "status" that becomes "DONE" and are polled at their "selfLink".
+	// Otherwise operations follow google.longrunning: they have a "done"
+	// field and are polled by name with the get method below.
+	compute bool
+	get     string // expression of the get method, relative to the service
+	details bool   // whether the error status has details
+	waiter  string // name of the generated waiter type
+}
+
+// findOperationSupport returns the operations that a's methods return, or nil
+// if there are none that the generator knows how to poll.
+func (a *API) findOperationSupport() *operationSupport {
+	returned := map[string]bool{}
+	var walk func(meths []*Method, rs []*disco.Resource)
+	walk = func(meths []*Method, rs []*disco.Resource) {
+		for _, m := range meths {
+			if m.m.Response != nil {
+				returned[m.m.Response.RefSchema.Name] = true
+			}
+		}
+		for _, r := range rs {
+			walk(a.resourceMethods(r), r.Resources)
+		}
+	}
+	walk(a.APIMethods(), a.doc.Resources)
+
+	for _, name := range a.sortedSchemaNames() {
+		s := a.schemas[name]
+		if !returned[name] || s.typ.Kind != disco.StructKind {
+			continue
+		}
+		if isComputeOperation(s.typ) {
+			return &operationSupport{schema: s, compute: true}
+		}
+		if status, ok := longrunningStatus(s.typ); ok {
+			if get := a.operationGetter(name); get != "" {
+				return &operationSupport{schema: s, get: get, details: schemaProperty(status, "details") != nil}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaProperty returns the schema of the property of s with the given name,
+// following references, or nil if s has no such property.
+func schemaProperty(s *disco.Schema, name string) *disco.Schema {
+	for _, p := range s.Properties {
+		if p.Name == name {
+			if p.Schema.RefSchema != nil {
+				return p.Schema.RefSchema
+			}
+			return p.Schema
+		}
+	}
+	return nil
+}
+
+// hasProperty reports whether s has a property with the given name and JSON type.
+func hasProperty(s *disco.Schema, name, typ string) bool {
+	p := schemaProperty(s, name)
+	return p != nil && p.Type == typ
+}
+
+// longrunningStatus reports whether s is a google.longrunning.Operation, and
+// returns the schema of its error, a google.rpc.Status.
+func longrunningStatus(s *disco.Schema) (*disco.Schema, bool) {
+	status := schemaProperty(s, "error")
+	if !hasProperty(s, "done", "boolean") || !hasProperty(s, "name", "string") || status == nil {
+		return nil, false
+	}
+	return status, hasProperty(status, "code", "integer") && hasProperty(status, "message", "string")
+}
+
+// isComputeOperation reports whether s is a Compute Engine style operation.
+func isComputeOperation(s *disco.Schema) bool {
+	status := schemaProperty(s, "status")
+	if status == nil || status.Type != "string" {
+		return false
+	}
+	hasDone := false
+	for _, e := range status.Enums {
+		hasDone = hasDone || e == "DONE"
+	}
+	errs := schemaProperty(s, "error")
+	if !hasDone || errs == nil || !hasProperty(s, "selfLink", "string") ||
+		!hasProperty(s, "httpErrorStatusCode", "integer") || !hasProperty(s, "httpErrorMessage", "string") {
+		return false
+	}
+	items := schemaProperty(errs, "errors")
+	if items == nil || items.Kind != disco.ArrayKind {
+		return false
+	}
+	item := items.ElementSchema()
+	if item.RefSchema != nil {
+		item = item.RefSchema
+	}
+	return hasProperty(item, "code", "string") && hasProperty(item, "message", "string")
+}
+
+// operationGetter returns the Go expression, relative to the service, of a
+// method that gets an operation of the named schema given only its name, or
+// "" if there is none.
+func (a *API) operationGetter(schemaName string) string {
+	var find func(expr string, rs []*disco.Resource, parent *disco.Resource) string
+	find = func(expr string, rs []*disco.Resource, parent *disco.Resource) string {
+		for _, r := range rs {
+			rexpr := expr + "." + resourceGoField(r, parent)
+			for _, m := range r.Methods {
+				if m.HTTPMethod == "GET" && m.Response != nil && m.Response.RefSchema.Name == schemaName &&
+					len(m.Parameters) == 1 && m.Parameters[0].Name == "name" &&
+					m.Parameters[0].Required && m.Parameters[0].Location == "path" {
+					return rexpr + "." + initialCap(m.Name)
+				}
+			}
+			if e := find(rexpr, r.Resources, r); e != "" {
+				return e
+			}
+		}
+		return ""
+	}
+	return find("s", a.doc.Resources, nil)
+}
+
+// generateResourceNames writes a Format and a Parse function for each form of
+// resource name taken by the methods of the API, such as
+// "projects/{project}/instances/{instance}". The forms are found by matching
+// the {+param} parameters in the paths of methods against their flatPaths.
+func (a *API) generateResourceNames() {
+	seen := map[string]bool{}
+	var forms [][]string
+	var walk func(meths disco.MethodList, rs disco.ResourceList)
+	walk = func(meths disco.MethodList, rs disco.ResourceList) {
+		for _, m := range meths {
+			collections := resourceNameCollections(m)
+			key := strings.Join(collections, "/")
+			if collections == nil || seen[key] {
+				continue
+			}
+			seen[key] = true
+			forms = append(forms, collections)
+		}
+		for _, r := range rs {
+			walk(r.Methods, r.Resources)
+		}
+	}
+	walk(a.doc.Methods, a.doc.Resources)
+	bases := resourceNameBases(forms)
+	for i, collections := range forms {
+		a.generateResourceName(collections, bases[i])
+	}
+}
+
+// resourceNameBases returns the names of the Format and Parse functions of
+// the resource names made of each of the given lists of collections, without
+// their "Format" and "Parse" prefixes. A name is made of the singular forms of
+// the last collections of its list, as few as are needed to tell it apart
+// from the other lists: "JobName" for ["projects", "jobs"] alone, but
+// "ProjectJobName" and "LocationJobName" if ["projects", "locations", "jobs"]
+// is also a list.
+func resourceNameBases(forms [][]string) []string {
+	suffixes := map[string]int{} // the number of lists ending in each path
+	for _, collections := range forms {
+		for k := 1; k <= len(collections); k++ {
+			suffixes[strings.Join(collections[len(collections)-k:], "/")]++
+		}
+	}
+	bases := make([]string, len(forms))
+	for i, collections := range forms {
+		k := 1
+		for k < len(collections) && suffixes[strings.Join(collections[len(collections)-k:], "/")] > 1 {
+			k++
+		}
+		bases[i] = resourceNameBase(collections[len(collections)-k:])
+	}
+	return bases
+}
+
+// resourceNameBase returns the name of a resource name made of collections,
+// such as "LocationJobName" for ["locations", "jobs"].
+func resourceNameBase(collections []string) string {
+	var b strings.Builder
+	for _, c := range collections {
+		b.WriteString(initialCap(singular(c)))
+	}
+	return b.String() + "Name"
+}
+
+// generateResourceName writes the Format and Parse functions of the resource
+// names made of the given collections, each followed by a resource ID. base is
+// the name of the functions without their prefixes.
+func (a *API) generateResourceName(collections []string, base string) {
+	pn := a.pn
+	np := new(namePool)
+	np.Get("name") // the parameter of Parse
+	np.Get("err")  // the error result of Parse
+	np.Get("v")    // the values parsed by Parse
+	var vars, segs []string
+	for _, c := range collections {
+		v := np.Get(validGoIdentifer(singular(c)))
+		vars = append(vars, v)
+		segs = append(segs, c, "{"+v+"}")
+	}
+	template := strings.Join(segs, "/")
+
+	if a.usedNames.m["Format"+base] || a.usedNames.m["Parse"+base] {
+		// Another identifier has the name, so use the whole path.
+		base = resourceNameBase(collections)
+	}
+	format, parse := a.GetName("Format"+base), a.GetName("Parse"+base)
+
+	a.p("\n%s", asComment("", fmt.Sprintf("%s returns the resource name %q with the given values. It returns an error if any of the values is empty or contains \"/\".", format, template)))
+	pn("func %s(%s string) (string, error) {", format, strings.Join(vars, ", "))
+	pn(" return gensupport.FormatResourceName(%q, %s)", template, strings.Join(vars, ", "))
+	pn("}")
+
+	var zeros, values []string
+	for i := range vars {
+		zeros = append(zeros, `""`)
+		values = append(values, fmt.Sprintf("v[%d]", i))
+	}
+	a.p("\n%s", asComment("", fmt.Sprintf("%s returns the values in name, a resource name of the form %q. It returns an error if name does not have that form.", parse, template)))
+	pn("func %s(name string) (%s string, err error) {", parse, strings.Join(vars, ", "))
+	pn(" v, err := gensupport.ParseResourceName(%q, name)", template)
+	pn(" if err != nil { return %s, err }", strings.Join(zeros, ", "))
+	pn(" return %s, nil", strings.Join(values, ", "))
+	pn("}")
+}
+
+// resourceNameCollections returns the names of the collections in the
+// resource names taken by the {+param} parameter in the path of m, such as
+// ["projects", "instances"] for "projects/{projectsId}/instances/{instancesId}".
+// They are found by matching the path against m's flatPath. It returns nil if
+// m's path has no such parameter, or if the matching part of the flatPath does
+// not alternate between collections and IDs.
+func resourceNameCollections(m *disco.Method) []string {
+	i := strings.Index(m.Path, "{+")
+	if i < 0 || m.FlatPath == "" {
+		return nil
+	}
+	j := strings.Index(m.Path[i:], "}")
+	if j < 0 {
+		return nil
+	}
+	prefix, suffix := m.Path[:i], m.Path[i+j+1:]
+	if strings.Contains(suffix, "{+") || len(m.FlatPath) < len(prefix)+len(suffix) ||
+		!strings.HasPrefix(m.FlatPath, prefix) || !strings.HasSuffix(m.FlatPath, suffix) {
+		return nil
+	}
+	segs := strings.Split(m.FlatPath[len(prefix):len(m.FlatPath)-len(suffix)], "/")
+	if len(segs)%2 != 0 {
+		return nil
+	}
+	var collections []string
+	for k := 0; k < len(segs); k += 2 {
+		c, id := segs[k], segs[k+1]
+		if !collectionRE.MatchString(c) || !strings.HasPrefix(id, "{") || !strings.HasSuffix(id, "}") ||
+			strings.ContainsAny(id[1:len(id)-1], "{}+") {
+			return nil
+		}
+		collections = append(collections, c)
+	}
+	return collections
+}
+
+var collectionRE = regexp.MustCompile(`^[a-zA-Z]+$`)
+
+// singular returns the singular form of the English plural noun s, as used
+// for the collections in resource names.
+func singular(s string) string {
+	switch {
+	case strings.HasSuffix(s, "ies"):
+		return strings.TrimSuffix(s, "ies") + "y"
+	case strings.HasSuffix(s, "sses"), strings.HasSuffix(s, "xes"),
+		strings.HasSuffix(s, "ches"), strings.HasSuffix(s, "shes"):
+		return strings.TrimSuffix(s, "es")
+	case strings.HasSuffix(s, "ss"):
+		return s
+	case strings.HasSuffix(s, "s"):
+		return strings.TrimSuffix(s, "s")
+	}
+	return s
+}
+
+func (a *API) generateOperationWaiter() {
+	pn := a.pn
+	service := a.ServiceType()
+	w := a.ops.waiter
+	op := a.ops.schema.GoName()
+
+	pn("\n// %s polls a long-running %s until it completes.", w, op)
+	pn("type %s struct {", w)
+	pn(" s *%s", service)
+	pn(" op *%s", op)
+	pn("}")
+
+	pn("\n// New%s returns an %s for op, which must have been", w, w)
+	pn("// returned by a method of s.")
+	pn("func (s *%s) New%s(op *%s) *%s {", service, w, op, w)
+	pn(" return &%s{s: s, op: op}", w)
+	pn("}")
+
+	pn("\n// Operation returns the most recently retrieved state of the operation.")
+	pn("func (w *%s) Operation() *%s { return w.op }", w, op)
+
+	pn("\n// Done reports whether the operation has completed.")
+	if a.ops.compute {
+		pn(`func (w *%s) Done() bool { return w.op.Status == "DONE" }`, w)
+	} else {
+		pn("func (w *%s) Done() bool { return w.op.Done }", w)
+	}
+
+	pn("\n// Err returns the error of a completed operation that failed, as a")
+	pn("// *googleapi.Error. It returns nil if the operation has not completed or")
+	pn("// succeeded.")
+	pn("func (w *%s) Err() error {", w)
+	pn(" if !w.Done() || w.op.Error == nil { return nil }")
+	if a.ops.compute {
+		pn(" e := &googleapi.Error{Code: int(w.op.HttpErrorStatusCode), Message: w.op.HttpErrorMessage}")
+		pn(" for _, item := range w.op.Error.Errors {")
+		pn("  e.Errors = append(e.Errors, googleapi.ErrorItem{Reason: item.Code, Message: item.Message})")
+		pn(" }")
+		pn(" return e")
+	} else if a.ops.details {
+		pn(" return gensupport.StatusError(w.op.Error.Code, w.op.Error.Message, w.op.Error.Details)")
+	} else {
+		pn(" return gensupport.StatusError(w.op.Error.Code, w.op.Error.Message, nil)")
+	}
+	pn("}")
+
+	pn("\n// Poll retrieves the current state of the operation, unless it has already")
+	pn("// completed, and returns Err.")
+	pn("func (w *%s) Poll(ctx context.Context) error {", w)
+	pn(" if !w.Done() {")
+	pn("  if err := w.refresh(ctx); err != nil { return err }")
+	pn(" }")
+	pn(" return w.Err()")
+	pn("}")
+
+	pn("\n// Wait polls the operation until it completes, pausing between polls as")
+	pn("// configured by opts, which may be nil. It returns Err, or the error of a")
+	pn("// failed poll or of ctx.")
+	pn("func (w *%s) Wait(ctx context.Context, opts *googleapi.WaitOptions) error {", w)
+	pn(" err := gensupport.WaitOperation(ctx, opts, w.Done, func() error { return w.refresh(ctx) })")
+	pn(" if err != nil { return err }")
+	pn(" return w.Err()")
+	pn("}")
+
+	if !a.ops.compute {
+		for _, p := range a.ops.schema.properties() {
+			if (p.p.Name != "response" && p.p.Name != "metadata") || p.TypeAsGo() != "googleapi.RawMessage" {
+				continue
+			}
+			pn("\n// Unmarshal%s decodes the %s of the operation into v.", p.GoName(), p.p.Name)
+			pn("func (w *%s) Unmarshal%s(v interface{}) error {", w, p.GoName())
+			pn(" if len(w.op.%s) == 0 { return errors.New(%q) }", p.GoName(), "operation has no "+p.p.Name)
+			pn(" return json.Unmarshal(w.op.%s, v)", p.GoName())
+			pn("}")
+		}
+	}
+
+	pn("\nfunc (w *%s) refresh(ctx context.Context) error {", w)
+	if a.ops.compute {
+		pn(` req, err := http.NewRequest("GET", gensupport.SelfLinkURL(w.s.BasePath, basePath, w.op.SelfLink), nil)`)
+		pn(" if err != nil { return err }")
+		pn(`req.Header.Set("x-goog-api-client", "gl-go/"+gensupport.GoVersion()+" gdcl/%s")`, version.Repo)
+		pn(`req.Header.Set("User-Agent", w.s.userAgent())`)
+		pn(" res, err := gensupport.SendRequest(ctx, w.s.client, req)")
+		pn(" if err != nil { return err }")
+		pn(" defer googleapi.CloseBody(res)")
+		pn(" if err := googleapi.CheckResponse(res); err != nil { return err }")
+		pn(" op := new(%s)", op)
+		pn(" if err := gensupport.DecodeResponse(op, res); err != nil { return err }")
+	} else {
+		pn(" s := w.s")
+		pn(" op, err := %s(w.op.Name).Context(ctx).Do()", a.ops.get)
+		pn(" if err != nil { return err }")
+	}
+	pn(" w.op = op")
+	pn(" return nil")
+	pn("}")
+}
+
 func (a *API) generateScopeConstants() {
 	scopes := a.doc.Auth.OAuth2Scopes
 	if len(scopes) == 0 {
@@ -935,14 +1672,63 @@ func (p *Property) EnumDescriptions() []string {
 	return nil
 }
 
+// enumSchema returns the schema holding the values of p if p is a string
+// enum or an array of them, or nil otherwise.
+func (p *Property) enumSchema() *disco.Schema {
+	typ := p.p.Schema
+	if typ.ItemSchema != nil {
+		typ = typ.ItemSchema
+	}
+	if typ.Enums == nil || typ.Type != "string" || typ.Format != "" {
+		return nil
+	}
+	return typ
+}
+
+func (p *Property) EnumDeprecated() []bool {
+	if dep := p.p.Schema.EnumDeprecated; dep != nil {
+		return dep
+	}
+	if items := p.p.Schema.ItemSchema; items != nil {
+		return items.EnumDeprecated
+	}
+	return nil
+}
+
+func (p *Property) Deprecated() bool {
+	return p.p.Schema.Deprecated
+}
+
 func (p *Property) Pattern() (string, bool) {
 	return p.p.Schema.Pattern, (p.p.Schema.Pattern != "")
 }
 
 func (p *Property) TypeAsGo() string {
+	if typ, ok := p.typedFormat(); ok {
+		return typ
+	}
 	return p.s.api.typeAsGo(p.Type(), false)
 }
 
+// typedFormatTypes maps the formats of string fields that are given richer Go
+// types, for APIs that opt in with --typed_formats, to those types.
+var typedFormatTypes = map[string]string{
+	"google-datetime":  "time.Time",
+	"google-duration":  "time.Duration",
+	"google-fieldmask": "googleapi.FieldMask",
+}
+
+// typedFormat returns the Go type of p if it is a string field whose format
+// has a richer Go type, and the API uses such types.
+func (p *Property) typedFormat() (string, bool) {
+	s := p.Type()
+	if !p.s.api.useTypedFormats() || s.Kind != disco.SimpleKind || s.Type != "string" {
+		return "", false
+	}
+	typ, ok := typedFormatTypes[s.Format]
+	return typ, ok
+}
+
 // A FieldName uniquely identifies a field within a Schema struct for an API.
 type fieldName struct {
 	api    string // The ID of an API.
@@ -1308,6 +2094,9 @@ func (s *Schema) writeSchemaCode(api *API) {
 		apitype := s.typ.Type
 		typ := mustSimpleTypeConvert(apitype, s.typ.Format)
 		s.api.pn("\ntype %s %s", s.GoName(), typ)
+		if s.typ.Enums != nil && typ == "string" {
+			api.enums = append(api.enums, &enumType{name: s.GoName(), schema: s.typ})
+		}
 	case disco.StructKind:
 		s.writeSchemaStruct(api)
 	case disco.MapKind, disco.AnyStructKind:
@@ -1343,15 +2132,165 @@ func (s *Schema) writeVariant(api *API, v *disco.Variant) {
 		s.api.pn(" return r, ok")
 		s.api.p("}\n\n")
 	}
+	s.writeVariantAccessors(v)
 }
 
-func (s *Schema) Description() string {
-	return removeMarkdownLinks(s.typ.Description)
-}
-
-func (s *Schema) writeSchemaStruct(api *API) {
-	if v := s.typ.Variant; v != nil {
-		s.writeVariant(api, v)
+// writeVariantAccessors writes the Variant method of a variant type, which
+// returns the member it holds, and an As and a Set method for each member.
+func (s *Schema) writeVariantAccessors(v *disco.Variant) {
+	p, pn := s.api.p, s.api.pn
+	var items []*disco.VariantMapItem
+	for _, m := range v.Map {
+		if m.TypeValue != "" && m.Ref != "" {
+			items = append(items, m)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+	member := func(m *disco.VariantMapItem) string {
+		if ms := s.api.schemas[m.Ref]; ms != nil {
+			return ms.GoName()
+		}
+		return m.Ref
+	}
+
+	p("%s", asComment("", fmt.Sprintf("Variant returns the member of the union that t holds, such as a *%s, "+
+		"depending on its %q property. It returns nil if the property has an unknown value "+
+		"or t cannot be converted to the member.", member(items[0]), v.Discriminant)))
+	pn("func (t %s) Variant() interface{} {", s.GoName())
+	pn(" var r interface{}")
+	pn(" switch t[%q] {", v.Discriminant)
+	for _, m := range items {
+		pn(" case %q:", m.TypeValue)
+		pn("  r = new(%s)", member(m))
+	}
+	pn(" default:")
+	pn("  return nil")
+	pn(" }")
+	pn(" if !googleapi.ConvertVariant(map[string]interface{}(t), r) {")
+	pn("  return nil")
+	pn(" }")
+	pn(" return r")
+	pn("}")
+
+	for _, m := range items {
+		name := initialCap(m.TypeValue)
+		p("\n%s", asComment("", fmt.Sprintf("As%s returns the member of the union that t holds if its %q property is %q.", name, v.Discriminant, m.TypeValue)))
+		pn("func (t %s) As%s() (*%s, bool) {", s.GoName(), name, member(m))
+		pn(" if t[%q] != %q {", v.Discriminant, m.TypeValue)
+		pn("  return nil, false")
+		pn(" }")
+		pn(" r, ok := t.Variant().(*%s)", member(m))
+		pn(" return r, ok")
+		pn("}")
+
+		p("\n%s", asComment("", fmt.Sprintf("Set%s makes t hold v, setting its %q property to %q.", name, v.Discriminant, m.TypeValue)))
+		pn("func (t *%s) Set%s(v *%s) error {", s.GoName(), name, member(m))
+		pn(" m, err := gensupport.MarshalVariant(v, %q, %q)", v.Discriminant, m.TypeValue)
+		pn(" if err != nil {")
+		pn("  return err")
+		pn(" }")
+		pn(" *t = m")
+		pn(" return nil")
+		pn("}")
+	}
+}
+
+// hasOutputOnlyFields reports whether ds or any schema it contains has an
+// output-only field. seen holds the schemas already visited.
+func hasOutputOnlyFields(ds *disco.Schema, seen map[*disco.Schema]bool) bool {
+	if ds == nil || seen[ds] {
+		return false
+	}
+	seen[ds] = true
+	if ds.RefSchema != nil {
+		return hasOutputOnlyFields(ds.RefSchema, seen)
+	}
+	for _, p := range ds.Properties {
+		if isOutputOnly(p) || hasOutputOnlyFields(p.Schema, seen) {
+			return true
+		}
+	}
+	return hasOutputOnlyFields(ds.ItemSchema, seen) || hasOutputOnlyFields(ds.AdditionalProperties, seen)
+}
+
+// isOutputOnly reports whether p is a field that the server sets, and so is
+// left out of the request bodies of create and update calls. Etags and
+// fingerprints are sometimes described as output only, but they are sent back
+// to the server to detect concurrent changes, so they never are.
+func isOutputOnly(p *disco.Property) bool {
+	if !p.Schema.OutputOnly {
+		return false
+	}
+	name := strings.ToLower(p.Name)
+	return name != "etag" && !strings.HasSuffix(name, "fingerprint")
+}
+
+// reserveConstructorNames reserves the names of the functions that return
+// services, so that constructors of schemas do not take them.
+func (a *API) reserveConstructorNames() {
+	a.GetName("New")
+	a.GetName("NewService")
+	var reserve func(r *disco.Resource)
+	reserve = func(r *disco.Resource) {
+		a.GetName("New" + resourceGoType(r))
+		for _, r2 := range r.Resources {
+			reserve(r2)
+		}
+	}
+	for _, r := range a.doc.Resources {
+		reserve(r)
+	}
+}
+
+// writeConstructor writes a function that returns a new s with the fields
+// that the API requires as arguments. A field is required if its description
+// says so, or if it is required by some method.
+func (s *Schema) writeConstructor() {
+	p, pn := s.api.p, s.api.pn
+	name := s.api.GetName("New" + s.GoName())
+	np := new(namePool)
+	var params, fields, docs []string
+	for _, prop := range s.properties() {
+		ps := prop.p.Schema
+		if prop.assignedGoName == "" || !ps.AlwaysRequired && len(ps.Annotations.Required) == 0 {
+			continue
+		}
+		typ := prop.TypeAsGo()
+		if prop.forcePointerType() {
+			typ = "*" + typ
+		}
+		param := np.Get(validGoIdentifer(prop.p.Name))
+		params = append(params, param+" "+typ)
+		fields = append(fields, fmt.Sprintf("%s: %s,", prop.assignedGoName, param))
+		if ps.AlwaysRequired {
+			docs = append(docs, fmt.Sprintf("- %s: Required.", param))
+		} else {
+			docs = append(docs, fmt.Sprintf("- %s: Required by %s.", param, strings.Join(ps.Annotations.Required, ", ")))
+		}
+	}
+	p("\n%s", asComment("", fmt.Sprintf("%s returns a new %s with its required fields set.", name, s.GoName())))
+	p("//\n")
+	for _, d := range docs {
+		p("%s", asFuncParmeterComment("", d, true))
+	}
+	pn("func %s(%s) *%s {", name, strings.Join(params, ", "), s.GoName())
+	pn(" return &%s{", s.GoName())
+	for _, f := range fields {
+		pn("  %s", f)
+	}
+	pn(" }")
+	pn("}")
+}
+
+func (s *Schema) Description() string {
+	return removeMarkdownLinks(s.typ.Description)
+}
+
+func (s *Schema) writeSchemaStruct(api *API) {
+	if v := s.typ.Variant; v != nil {
+		s.writeVariant(api, v)
 		return
 	}
 	s.api.p("\n")
@@ -1369,6 +2308,7 @@ func (s *Schema) writeSchemaStruct(api *API) {
 	}
 
 	firstFieldName := "" // used to store a struct field name for use in documentation.
+	hasRequired := false
 	for i, p := range s.properties() {
 		if i > 0 {
 			s.api.p("\n")
@@ -1380,6 +2320,16 @@ func (s *Schema) writeSchemaStruct(api *API) {
 			continue
 		}
 		p.assignedGoName = pname
+		if p.p.Schema.AlwaysRequired || len(p.p.Schema.Annotations.Required) > 0 {
+			hasRequired = true
+		}
+		if es := p.enumSchema(); es != nil {
+			api.enums = append(api.enums, &enumType{
+				base:   s.GoName() + pname,
+				doc:    fmt.Sprintf("%s.%s", s.GoName(), pname),
+				schema: es,
+			})
+		}
 		des := p.Description()
 		if des != "" {
 			if pname == "Deprecated" {
@@ -1390,6 +2340,10 @@ func (s *Schema) writeSchemaStruct(api *API) {
 			}
 		}
 		addFieldValueComments(s.api.p, p, "\t", des != "")
+		if p.Deprecated() {
+			_, hasEnum := p.Enum()
+			addDeprecatedComment(s.api.p, des, "\t", des != "" || hasEnum || p.UnfortunateDefault())
+		}
 
 		var extraOpt string
 		if p.Type().IsIntAsString() {
@@ -1401,11 +2355,21 @@ func (s *Schema) writeSchemaStruct(api *API) {
 			typ = "*" + typ
 		}
 
-		s.api.pn(" %s %s `json:\"%s,omitempty%s\"`", pname, typ, p.p.Name, extraOpt)
+		var extraTag string
+		if isOutputOnly(p.p) {
+			extraTag = ` googleapi:"outputonly"`
+		} else if p.p.Schema.AlwaysRequired {
+			extraTag = ` googleapi:"required"`
+		}
+
+		s.api.pn(" %s %s `json:\"%s,omitempty%s\"%s`", pname, typ, p.p.Name, extraOpt, extraTag)
 		if firstFieldName == "" {
 			firstFieldName = pname
 		}
 	}
+	if hasRequired {
+		api.ctors = append(api.ctors, s)
+	}
 
 	if s.isResponseType() {
 		if firstFieldName != "" {
@@ -1466,13 +2430,16 @@ func (s *Schema) writeSchemaMarshal(forceSendFieldName, nullFieldsName string) {
 }
 
 func (s *Schema) writeSchemaUnmarshal() {
-	var floatProps []*Property
+	var floatProps, durationProps []*Property
 	for _, p := range s.properties() {
 		if p.p.Schema.Type == "number" {
 			floatProps = append(floatProps, p)
 		}
+		if typ, _ := p.typedFormat(); typ == "time.Duration" {
+			durationProps = append(durationProps, p)
+		}
 	}
-	if len(floatProps) == 0 {
+	if len(floatProps) == 0 && len(durationProps) == 0 {
 		return
 	}
 	pn := s.api.pn
@@ -1488,6 +2455,14 @@ func (s *Schema) writeSchemaUnmarshal() {
 		}
 		pn("%s %s `json:\"%s\"`", p.assignedGoName, typ, p.p.Name)
 	}
+	// Likewise for durations, which are transmitted as strings like "3.5s".
+	for _, p := range durationProps {
+		typ := "gensupport.JSONDuration"
+		if p.forcePointerType() {
+			typ = "*" + typ
+		}
+		pn("%s %s `json:\"%s\"`", p.assignedGoName, typ, p.p.Name)
+	}
 	pn("    *NoMethod") // embed the schema
 	pn("  }")
 	// Set the schema value into the wrapper so its other fields are unmarshaled.
@@ -1504,6 +2479,14 @@ func (s *Schema) writeSchemaUnmarshal() {
 			pn("s.%s = float64(s1.%s)", n, n)
 		}
 	}
+	for _, p := range durationProps {
+		n := p.assignedGoName
+		if p.forcePointerType() {
+			pn("if s1.%s != nil { s.%s = (*time.Duration)(s1.%s) }", n, n, n)
+		} else {
+			pn("s.%s = time.Duration(s1.%s)", n, n)
+		}
+	}
 	pn(" return nil")
 	pn("}")
 }
@@ -1583,6 +2566,241 @@ func (a *API) generateResourceMethods(r *disco.Resource) {
 	}
 }
 
+// generateInterfaces writes, for each resource service, an interface of its
+// methods, and for each call they return, an interface of the call's methods.
+// Code that depends on these interfaces rather than on the concrete types can
+// be tested with fakes. Since the methods of the concrete types return
+// concrete calls, they are adapted to the interfaces by unexported wrappers.
+//
+// src is the code generated so far, which is parsed to find the methods of
+// each type.
+func (a *API) generateInterfaces(src []byte) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return err
+	}
+	g := &interfaceGen{
+		api:     a,
+		fset:    fset,
+		methods: make(map[string][]*ast.FuncDecl),
+		callers: make(map[string]string),
+	}
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Recv == nil || !fd.Name.IsExported() {
+			continue
+		}
+		if t := pointerTypeName(fd.Recv.List[0].Type); t != "" {
+			g.methods[t] = append(g.methods[t], fd)
+		}
+	}
+	for _, res := range a.doc.Resources {
+		g.generateResource(res)
+	}
+	return nil
+}
+
+// interfaceGen holds the state of generateInterfaces.
+type interfaceGen struct {
+	api     *API
+	fset    *token.FileSet
+	methods map[string][]*ast.FuncDecl // exported methods, by receiver type
+	callers map[string]string          // interface name, by call type
+}
+
+// generateResource writes the interface of the service of r and its wrapper,
+// then those of the calls returned by the service, then those of the
+// services of r's sub-resources.
+func (g *interfaceGen) generateResource(r *disco.Resource) {
+	pn := g.api.pn
+	t := resourceGoType(r)
+	it := resourceAPIType(r)
+	impl := unexportedName(it)
+	var calls []string
+
+	g.api.p("\n%s", asComment("", fmt.Sprintf("%s is the interface of %s. Code that depends on it rather than on %s can be tested with a fake implementation.", it, t, t)))
+	pn("type %s interface {", it)
+	for _, fd := range g.methods[t] {
+		if call := g.callResult(fd); call != "" {
+			calls = append(calls, call)
+			pn("%s(%s) %s", fd.Name.Name, g.params(fd), g.caller(call))
+			continue
+		}
+		pn("%s(%s) %s", fd.Name.Name, g.params(fd), g.results(fd))
+	}
+	for _, res := range r.Resources {
+		pn("%s() %s", resourceGoField(res, r), resourceAPIType(res))
+	}
+	pn("}")
+
+	g.api.p("\n%s", asComment("", fmt.Sprintf("%s implements %s with a %s.", impl, it, t)))
+	pn("type %s struct{ *%s }", impl, t)
+	for _, fd := range g.methods[t] {
+		if call := g.callResult(fd); call != "" {
+			pn("\nfunc (r %s) %s(%s) %s {", impl, fd.Name.Name, g.params(fd), g.caller(call))
+			pn("return %s{r.%s.%s(%s)}", unexportedName(g.caller(call)), t, fd.Name.Name, g.args(fd))
+			pn("}")
+		}
+	}
+	for _, res := range r.Resources {
+		f := resourceGoField(res, r)
+		pn("\nfunc (r %s) %s() %s {", impl, f, resourceAPIType(res))
+		pn("return %s{r.%s.%s}", unexportedName(resourceAPIType(res)), t, f)
+		pn("}")
+	}
+
+	for _, call := range calls {
+		g.generateCall(call)
+	}
+	for _, res := range r.Resources {
+		g.generateResource(res)
+	}
+}
+
+// generateCall writes the interface of the call type call and its wrapper.
+// Methods that return the call, such as optional parameter setters, return
+// the interface instead.
+func (g *interfaceGen) generateCall(call string) {
+	pn := g.api.pn
+	it := g.caller(call)
+	impl := unexportedName(it)
+
+	g.api.p("\n%s", asComment("", fmt.Sprintf("%s is the interface of %s.", it, call)))
+	pn("type %s interface {", it)
+	for _, fd := range g.methods[call] {
+		if g.callResult(fd) == call {
+			pn("%s(%s) %s", fd.Name.Name, g.params(fd), it)
+			continue
+		}
+		pn("%s(%s) %s", fd.Name.Name, g.params(fd), g.results(fd))
+	}
+	pn("}")
+
+	g.api.p("\n%s", asComment("", fmt.Sprintf("%s implements %s with a %s.", impl, it, call)))
+	pn("type %s struct{ *%s }", impl, call)
+	for _, fd := range g.methods[call] {
+		if g.callResult(fd) == call {
+			pn("\nfunc (c %s) %s(%s) %s {", impl, fd.Name.Name, g.params(fd), it)
+			pn("c.%s.%s(%s)", call, fd.Name.Name, g.args(fd))
+			pn("return c")
+			pn("}")
+		}
+	}
+}
+
+// caller returns the name of the interface of the call type call.
+func (g *interfaceGen) caller(call string) string {
+	if name, ok := g.callers[call]; ok {
+		return name
+	}
+	name := g.api.GetName(call + "er")
+	g.callers[call] = name
+	return name
+}
+
+// callResult returns the name of the call type returned by fd, or "" if fd
+// does not return a single pointer to a call.
+func (g *interfaceGen) callResult(fd *ast.FuncDecl) string {
+	res := fd.Type.Results
+	if res == nil || len(res.List) != 1 || len(res.List[0].Names) > 1 {
+		return ""
+	}
+	t := pointerTypeName(res.List[0].Type)
+	if !g.isCall(t) {
+		return ""
+	}
+	return t
+}
+
+// isCall reports whether t is a call type, going by the Context and Header
+// methods that every call has.
+func (g *interfaceGen) isCall(t string) bool {
+	var ctx, header bool
+	for _, fd := range g.methods[t] {
+		switch fd.Name.Name {
+		case "Context":
+			ctx = true
+		case "Header":
+			header = true
+		}
+	}
+	return ctx && header
+}
+
+// params returns the parameter list of fd, without parentheses.
+func (g *interfaceGen) params(fd *ast.FuncDecl) string {
+	var l []string
+	for _, f := range fd.Type.Params.List {
+		var names []string
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		l = append(l, strings.TrimSpace(strings.Join(names, ", ")+" "+g.expr(f.Type)))
+	}
+	return strings.Join(l, ", ")
+}
+
+// args returns the arguments that pass the parameters of fd on to another
+// function with the same parameters.
+func (g *interfaceGen) args(fd *ast.FuncDecl) string {
+	var l []string
+	for _, f := range fd.Type.Params.List {
+		if len(f.Names) == 0 {
+			panicf("method %s has an unnamed parameter", fd.Name.Name)
+		}
+		for _, n := range f.Names {
+			l = append(l, n.Name)
+		}
+		if _, ok := f.Type.(*ast.Ellipsis); ok {
+			l[len(l)-1] += "..."
+		}
+	}
+	return strings.Join(l, ", ")
+}
+
+// results returns the result list of fd, in parentheses if needed.
+func (g *interfaceGen) results(fd *ast.FuncDecl) string {
+	res := fd.Type.Results
+	if res == nil {
+		return ""
+	}
+	if len(res.List) == 1 && len(res.List[0].Names) == 0 {
+		return g.expr(res.List[0].Type)
+	}
+	var l []string
+	for _, f := range res.List {
+		var names []string
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		l = append(l, strings.TrimSpace(strings.Join(names, ", ")+" "+g.expr(f.Type)))
+	}
+	return "(" + strings.Join(l, ", ") + ")"
+}
+
+// expr returns the source of the type expression e.
+func (g *interfaceGen) expr(e ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, g.fset, e); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+// pointerTypeName returns T if e is the type expression *T, or "" if not.
+func pointerTypeName(e ast.Expr) string {
+	star, ok := e.(*ast.StarExpr)
+	if !ok {
+		return ""
+	}
+	id, ok := star.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return id.Name
+}
+
 func resourceGoField(r, parent *disco.Resource) string {
 	// Avoid conflicts with method names.
 	und := ""
@@ -1602,6 +2820,17 @@ func resourceGoType(r *disco.Resource) string {
 	return initialCap(r.FullName + "Service")
 }
 
+// resourceAPIType returns the name of the interface generated for the
+// service of r with --interfaces, such as "FilesAPI" for FilesService.
+func resourceAPIType(r *disco.Resource) string {
+	return strings.TrimSuffix(resourceGoType(r), "Service") + "API"
+}
+
+// unexportedName returns name with its first letter in lower case.
+func unexportedName(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
 func (a *API) resourceMethods(r *disco.Resource) []*Method {
 	ms := []*Method{}
 	for _, m := range r.Methods {
@@ -1630,6 +2859,18 @@ func (m *Method) responseType() *Schema {
 	return m.api.schemas[m.m.Response.RefSchema.Name]
 }
 
+// writesResource reports whether m creates or updates a resource, as insert,
+// create, update and patch methods do. Output-only fields are only left out of
+// the request bodies of these: the bodies of other methods are not resources
+// read from the server.
+func (m *Method) writesResource() bool {
+	switch m.m.Name {
+	case "insert", "create", "update", "patch":
+		return true
+	}
+	return false
+}
+
 func (m *Method) supportsMediaUpload() bool {
 	return m.m.MediaUpload != nil
 }
@@ -1648,6 +2889,12 @@ func (m *Method) supportsMediaDownload() bool {
 	return m.m.SupportsMediaDownload
 }
 
+// supportsBatch reports whether calls of m can be added to a batch request.
+// Media uploads can't be sent through the batch endpoint.
+func (m *Method) supportsBatch() bool {
+	return m.api.supportsBatch() && !m.supportsMediaUpload() && !m.IsRawRequest()
+}
+
 func (m *Method) supportsPaging() (*pageTokenGenerator, string, bool) {
 	ptg := m.pageTokenGenerator()
 	if ptg == nil {
@@ -1668,6 +2915,45 @@ func (m *Method) supportsPaging() (*pageTokenGenerator, string, bool) {
 	return nil, "", false
 }
 
+// pageItems returns the property of m's response that holds the items of
+// each page, and the Go type of an item. If the response has several list
+// fields, the only one holding objects is used; if that is ambiguous, ok is
+// false.
+func (m *Method) pageItems() (prop *Property, itemType string, ok bool) {
+	var lists, objectLists []*Property
+	for _, prop := range m.responseType().properties() {
+		if prop.Type().Kind != disco.ArrayKind || !strings.HasPrefix(prop.TypeAsGo(), "[]") {
+			continue
+		}
+		lists = append(lists, prop)
+		es := prop.Type().ElementSchema()
+		if es.Kind == disco.ReferenceKind {
+			es = es.RefSchema
+		}
+		if es.Kind == disco.StructKind {
+			objectLists = append(objectLists, prop)
+		}
+	}
+	if len(objectLists) == 1 {
+		lists = objectLists
+	}
+	if len(lists) != 1 {
+		return nil, "", false
+	}
+	return lists[0], strings.TrimPrefix(lists[0].TypeAsGo(), "[]"), true
+}
+
+// pageSizeParam returns the optional parameter of m that limits the number
+// of items in a page, or nil if there is none.
+func (m *Method) pageSizeParam() *Param {
+	for _, p := range m.OptParams() {
+		if (p.p.Name == "pageSize" || p.p.Name == "maxResults") && !p.p.Repeated && p.GoType() == "int64" && p.p.Location == "query" {
+			return p
+		}
+	}
+	return nil
+}
+
 type pageTokenGenerator struct {
 	isParam     bool   // is the page token a URL parameter?
 	name        string // param or request field name
@@ -1823,6 +3109,23 @@ func (meth *Method) generateCode() {
 	}
 	callName := a.GetName(prefix + methodName + "Call")
 
+	// Enum types of the parameters, by parameter name.
+	enumTypes := map[string]string{}
+	for _, param := range meth.Params() {
+		if param.p.Enums == nil || param.GoType() != "string" {
+			continue
+		}
+		owner := "Service"
+		if res != nil {
+			owner = resourceGoType(res)
+		}
+		enumTypes[param.p.Name] = a.writeEnum(&enumType{
+			base:   prefix + methodName + initialCap(param.p.Name),
+			doc:    fmt.Sprintf("the %q parameter of %s.%s", param.p.Name, owner, methodName),
+			schema: &param.p.Schema,
+		})
+	}
+
 	pn("\ntype %s struct {", callName)
 	pn(" s *%s", a.ServiceType())
 	for _, arg := range args.l {
@@ -1841,6 +3144,7 @@ func (meth *Method) generateCode() {
 	}
 	pn(" ctx_ context.Context")
 	pn(" header_ http.Header")
+	pn(" retry_ *googleapi.RetryConfig")
 	pn("}")
 
 	p("\n%s", asComment("", methodName+": "+removeMarkdownLinks(meth.m.Description)))
@@ -1863,6 +3167,9 @@ func (meth *Method) generateCode() {
 			pn("// For details, see %v", url)
 		}
 	}
+	if meth.m.Deprecated {
+		addDeprecatedComment(p, meth.m.Description, "", true)
+	}
 
 	var servicePtr string
 	if res == nil {
@@ -1912,6 +3219,9 @@ func (meth *Method) generateCode() {
 		des = strings.TrimSpace(des)
 		p("\n%s", asComment("", fmt.Sprintf("%s sets the optional parameter %q: %s", setter, opt.p.Name, removeMarkdownLinks(des))))
 		addFieldValueComments(p, opt, "", true)
+		if opt.Deprecated() {
+			addDeprecatedComment(p, des, "", true)
+		}
 		np := new(namePool)
 		np.Get("c") // take the receiver's name
 		paramName := np.Get(validGoIdentifer(opt.p.Name))
@@ -1936,6 +3246,32 @@ func (meth *Method) generateCode() {
 		}
 		pn("return c")
 		pn("}")
+
+		enumType := enumTypes[opt.p.Name]
+		if enumType == "" || len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == setter+"Enum" })) > 0 {
+			continue
+		}
+		p("\n%s", asComment("", fmt.Sprintf("%sEnum sets the optional parameter %q to one of the %s values.", setter, opt.p.Name, enumType)))
+		if opt.Deprecated() {
+			addDeprecatedComment(p, des, "", true)
+		}
+		if opt.p.Repeated {
+			pn("func (c *%s) %sEnum(%s ...%s) *%s {", callName, setter, paramName, enumType, callName)
+			pn(" var s []string")
+			pn(" for _, v := range %s {", paramName)
+			pn("  s = append(s, string(v))")
+			pn(" }")
+			pn(" c.urlParams_.SetMulti(%q, s)", opt.p.Name)
+		} else {
+			pn("func (c *%s) %sEnum(%s %s) *%s {", callName, setter, paramName, enumType, callName)
+			pn(" c.urlParams_.Set(%q, string(%s))", opt.p.Name, paramName)
+		}
+		pn("return c")
+		pn("}")
+	}
+
+	if ba := args.bodyArg(); ba != nil && httpMethod == "PATCH" {
+		meth.generatePatchMask(callName, ba)
 	}
 
 	if meth.supportsMediaUpload() {
@@ -1984,6 +3320,7 @@ func (meth *Method) generateCode() {
 		pn(`c.mediaInfo_.SetProgressUpdater(pu)`)
 		pn("return c")
 		pn("}")
+		meth.generateUploadSession(callName)
 	}
 
 	comment := "Fields allows partial responses to be retrieved. " +
@@ -2027,6 +3364,17 @@ func (meth *Method) generateCode() {
 	pn("return c")
 	pn("}")
 
+	if len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == "Retryer" })) == 0 {
+		pn("\n// Retryer sets how this call is retried if it fails, overriding any")
+		pn("// configuration set for the service with option.WithRetryConfig.")
+		pn("func (c *%s) Retryer(rc *googleapi.RetryConfig) *%s {", callName, callName)
+		pn("c.retry_ = rc")
+		pn("return c")
+		pn("}")
+	}
+
+	meth.generateValidate(callName, args)
+
 	comment = "Header returns an http.Header that can be modified by the caller to add " +
 		"HTTP headers to the request."
 	p("\n%s", asComment("", comment))
@@ -2063,7 +3411,12 @@ func (meth *Method) generateCode() {
 				if a.needsDataWrapper() {
 					style = "WithDataWrapper"
 				}
-				pn("body, err := googleapi.%s.JSONReader(c.%s)", style, ba.goname)
+				v := "c." + ba.goname
+				if meth.writesResource() && hasOutputOnlyFields(ba.schema.typ, map[*disco.Schema]bool{}) {
+					// Don't send fields that the server sets.
+					v = fmt.Sprintf("gensupport.WithoutOutputOnly(%s)", v)
+				}
+				pn("body, err := googleapi.%s.JSONReader(%s)", style, v)
 				pn("if err != nil { return nil, err }")
 			}
 
@@ -2074,6 +3427,11 @@ func (meth *Method) generateCode() {
 	}
 
 	pn("urls := googleapi.ResolveRelative(c.s.BasePath, %q)", meth.m.Path)
+	if meth.supportsMediaDownload() && meth.m.UseMediaDownloadService {
+		pn(`if alt == "media" {`)
+		pn("  urls = googleapi.ResolveRelative(c.s.BasePath, %q)", "/download/"+a.doc.ServicePath+meth.m.Path)
+		pn("}")
+	}
 	if meth.supportsMediaUpload() {
 		pn("if c.mediaInfo_ != nil {")
 		pn("  urls = googleapi.ResolveRelative(c.s.BasePath, %q)", meth.mediaUploadPath())
@@ -2105,11 +3463,12 @@ func (meth *Method) generateCode() {
 		}
 		pn(`})`)
 	}
+	pn("retry := c.retry_")
+	pn("if retry == nil { retry = c.s.retry }")
 	if meth.supportsMediaUpload() && meth.api.Name == "storage" {
-		pn("return gensupport.SendRequestWithRetry(c.ctx_, c.s.client, req)")
-	} else {
-		pn("return gensupport.SendRequest(c.ctx_, c.s.client, req)")
+		pn("if retry == nil { return gensupport.SendRequestWithRetry(c.ctx_, c.s.client, req) }")
 	}
+	pn("return gensupport.SendRequestWithRetryConfig(c.ctx_, c.s.client, req, retry)")
 	pn("}")
 
 	if meth.supportsMediaDownload() {
@@ -2130,6 +3489,17 @@ func (meth *Method) generateCode() {
 		pn("}")
 		pn("return res, nil")
 		pn("}")
+		pn("\n// DownloadVerified is like Download, but the body of the returned Response")
+		pn("// computes the CRC32C and MD5 checksums of the media as it is read. If the")
+		pn("// body is read to the end, its Close method returns an error if they do not")
+		pn("// match the checksums the server sent for the media.")
+		pn("func (c *%s) DownloadVerified(opts ...googleapi.CallOption) (*http.Response, error) {", callName)
+		pn("res, err := c.Download(opts...)")
+		pn("if err != nil { return nil, err }")
+		pn("res.Body = gensupport.NewVerifyingReader(res)")
+		pn("return res, nil")
+		pn("}")
+		meth.generateRangedDownload(callName)
 	}
 
 	mapRetType := strings.HasPrefix(retTypeComma, "map[")
@@ -2153,7 +3523,16 @@ func (meth *Method) generateCode() {
 	if meth.IsRawResponse() {
 		pn(`return c.doRequest("")`)
 	} else {
-		pn(`res, err := c.doRequest("json")`)
+		if meth.supportsMediaUpload() {
+			// A resumed upload doesn't send the request that starts an upload.
+			pn("var res *http.Response")
+			pn("var err error")
+			pn("rx := c.mediaInfo_.ResumedUpload()")
+			pn("if rx == nil {")
+			pn(`res, err = c.doRequest("json")`)
+		} else {
+			pn(`res, err := c.doRequest("json")`)
+		}
 
 		if retTypeComma != "" && !mapRetType {
 			pn("if res != nil && res.StatusCode == http.StatusNotModified {")
@@ -2168,7 +3547,8 @@ func (meth *Method) generateCode() {
 		pn("defer googleapi.CloseBody(res)")
 		pn("if err := googleapi.CheckResponse(res); err != nil { return %serr }", nilRet)
 		if meth.supportsMediaUpload() {
-			pn(`rx := c.mediaInfo_.ResumableUpload(res.Header.Get("Location"))`)
+			pn(`rx = c.mediaInfo_.ResumableUpload(res.Header.Get("Location"))`)
+			pn("}")
 			pn("if rx != nil {")
 			pn(" rx.Client = c.s.client")
 			pn(" rx.UserAgent = c.s.userAgent()")
@@ -2182,6 +3562,8 @@ func (meth *Method) generateCode() {
 			pn(" defer res.Body.Close()")
 			pn(" if err := googleapi.CheckResponse(res); err != nil { return %serr }", nilRet)
 			pn("}")
+			pn("if err := c.mediaInfo_.VerifyChecksums(res); err != nil { return %serr }", nilRet)
+			pn("c.mediaInfo_.UploadComplete()")
 		}
 		if retTypeComma == "" {
 			pn("return nil")
@@ -2241,7 +3623,356 @@ func (meth *Method) generateCode() {
 		pn(ptg.genSet("x." + rname))
 		pn(" }")
 		pn("}")
+
+		if prop, itemType, ok := meth.pageItems(); ok {
+			meth.generateIterator(callName, retType, ptg, rname, prop.GoName(), itemType)
+			if len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == "Stream" })) == 0 {
+				meth.generateStream(callName, retType, ptg, rname, prop, itemType)
+			}
+		}
+	}
+
+	if ops := a.ops; ops != nil && meth.m.Response != nil && meth.responseType() == ops.schema && len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == "Wait" })) == 0 {
+		pn("")
+		pn("// Wait calls Do and waits for the returned operation to complete, as")
+		pn("// %s.Wait does. It returns the operation's final state.", ops.waiter)
+		pn("// The provided context supersedes any context provided to the Context method.")
+		pn("func (c *%s) Wait(ctx context.Context, opts *googleapi.WaitOptions) (*%s, error) {", callName, ops.schema.GoName())
+		pn(" c.ctx_ = ctx")
+		pn(" op, err := c.Do()")
+		pn(" if err != nil { return nil, err }")
+		pn(" w := c.s.New%s(op)", ops.waiter)
+		pn(" err = w.Wait(ctx, opts)")
+		pn(" return w.Operation(), err")
+		pn("}")
+	}
+
+	if meth.supportsBatch() && len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == a.batchType })) == 0 {
+		pn("")
+		pn("// %s adds the call to b. When b is sent, f is called with the results", a.batchType)
+		pn("// that Do would have returned. The call must not be modified or added to")
+		pn("// another %s after this, and any context set with the Context method is", a.batchType)
+		pn("// replaced with the one passed to b's Do method.")
+		pn("func (c *%s) %s(b *%s, f func(%serror)) {", callName, a.batchType, a.batchType, retTypeComma)
+		pn(" b.b.Add(func(ctx context.Context, client *http.Client) {")
+		pn("  s := *c.s")
+		pn("  s.client = client")
+		pn("  c.s = &s")
+		pn("  c.ctx_ = ctx")
+		pn("  f(c.Do())")
+		pn(" })")
+		pn("}")
+	}
+}
+
+// generateUploadSession writes the methods of a call that supports media
+// uploads that report the progress of an upload, and that save and resume the
+// session of a resumable upload.
+func (meth *Method) generateUploadSession(callName string) {
+	a := meth.api
+	p, pn := a.p, a.pn
+	collides := func(name string) bool {
+		return len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == name })) > 0
+	}
+	if !collides("UploadProgressUpdater") {
+		p("\n%s", asComment("", "UploadProgressUpdater provides a callback function that will be called "+
+			"with the progress of the upload: the bytes read and committed, the chunk, "+
+			"the retries, the rate and the estimated time left. Unlike ProgressUpdater, "+
+			"it is called for uploads in a single request too. "+
+			"It must be called after Media, ResumableMedia or ResumeUpload."))
+		pn("func (c *%s) UploadProgressUpdater(u googleapi.UploadProgressUpdater) *%s {", callName, callName)
+		pn("c.mediaInfo_.SetUploadProgressUpdater(u)")
+		pn("return c")
+		pn("}")
+	}
+	if !collides("UploadSessionUpdater") {
+		p("\n%s", asComment("", "UploadSessionUpdater provides a callback function that will be called "+
+			"with the session of a resumable upload when it starts and after every chunk. "+
+			"The session can be saved and passed to ResumeUpload to finish the upload later, "+
+			"possibly in another process. It must be called after Media or ResumableMedia."))
+		pn("func (c *%s) UploadSessionUpdater(u googleapi.UploadSessionUpdater) *%s {", callName, callName)
+		pn("c.mediaInfo_.SetSessionUpdater(u)")
+		pn("return c")
+		pn("}")
+	}
+	if !collides("ResumeUpload") {
+		p("\n%s", asComment("", "ResumeUpload makes Do finish the resumable upload described by session, "+
+			"which was saved by the callback set with UploadSessionUpdater, instead of starting a new one. "+
+			"r holds the whole media, whose size is size. Do asks the server how much of the media "+
+			"it has, and uploads the rest. The other parameters and the request body of the call are not sent."+
+			"\n\nAt most one of Media, ResumableMedia and ResumeUpload may be set."))
+		pn("func (c *%s) ResumeUpload(session *googleapi.UploadSession, r io.ReaderAt, size int64) *%s {", callName, callName)
+		pn("c.mediaInfo_ = gensupport.NewInfoFromUploadSession(session, r, size)")
+		pn("return c")
+		pn("}")
+	}
+}
+
+// generateRangedDownload writes the DownloadRange and DownloadTo methods of a
+// call that supports media downloads, and the sendMedia method they share.
+func (meth *Method) generateRangedDownload(callName string) {
+	a := meth.api
+	p, pn := a.p, a.pn
+	collides := func(name string) bool {
+		return len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == name })) > 0
+	}
+	if !collides("DownloadRange") {
+		p("\n%s", asComment("", "DownloadRange fetches length bytes of the media, starting at offset, "+
+			"or all of the media from offset on if length is zero, and checks that the "+
+			"response holds those bytes. If the returned error is nil, the Response is "+
+			"guaranteed to have a 2xx status code. Callers must close the Response.Body as usual."))
+		pn("func (c *%s) DownloadRange(offset, length int64, opts ...googleapi.CallOption) (*http.Response, error) {", callName)
+		pn("gensupport.SetOptions(c.urlParams_, opts...)")
+		pn("return gensupport.DownloadRange(c.ctx_, c.sendMedia, offset, length)")
+		pn("}")
+	}
+	if !collides("DownloadTo") {
+		p("\n%s", asComment("", "DownloadTo writes the media to w and returns the number of bytes "+
+			"written. A download that fails with a transient error is resumed from where it "+
+			"stopped, unless the media has changed in the meantime. If the server sends "+
+			"checksums of the media, they are verified once the download is complete."))
+		pn("func (c *%s) DownloadTo(ctx context.Context, w io.WriterAt, opts ...googleapi.CallOption) (int64, error) {", callName)
+		pn("gensupport.SetOptions(c.urlParams_, opts...)")
+		pn("return gensupport.DownloadTo(ctx, w, c.sendMedia)")
+		pn("}")
+	}
+	pn("\n// sendMedia requests the media with the given Range header. It is a")
+	pn("// gensupport.MediaSender.")
+	pn("func (c *%s) sendMedia(ctx context.Context, rangeHeader string) (*http.Response, error) {", callName)
+	pn("cc := *c")
+	pn("cc.header_ = make(http.Header)")
+	pn("for k, v := range c.header_ {")
+	pn(" cc.header_[k] = v")
+	pn("}")
+	pn(`if rangeHeader != "" {`)
+	pn(` cc.header_.Set("Range", rangeHeader)`)
+	pn("}")
+	pn("if ctx != nil {")
+	pn(" cc.ctx_ = ctx")
+	pn("}")
+	pn(`res, err := cc.doRequest("media")`)
+	pn("if err != nil { return nil, err }")
+	if a.Name == "storage" {
+		pn("if err := googleapi.CheckMediaResponse(res); err != nil {")
+	} else {
+		pn("if err := googleapi.CheckResponse(res); err != nil {")
+	}
+	pn("res.Body.Close()")
+	pn("return nil, err")
+	pn("}")
+	pn("return res, nil")
+	pn("}")
+}
+
+// generatePatchMask writes a method of a Patch call that sets its update mask
+// parameter from the difference between the request body and an older
+// version of it. The method is only written if the call has an optional
+// parameter for the mask.
+func (meth *Method) generatePatchMask(callName string, body *argument) {
+	p, pn := meth.api.p, meth.api.pn
+	var mask *Param
+	for _, opt := range meth.OptParams() {
+		if opt.p.Format == "google-fieldmask" || opt.p.Name == "updateMask" {
+			mask = opt
+			break
+		}
+	}
+	if mask == nil {
+		return
+	}
+	name := initialCap(mask.p.Name) + "From"
+	if len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == name })) > 0 {
+		return
+	}
+	comment := fmt.Sprintf("%s sets the optional parameter %q to the paths of the fields of the "+
+		"request body that differ from old, an earlier version of it, and removes the other fields "+
+		"from the request body. Fields in the body's ForceSendFields and NullFields are always included. "+
+		"If no field differs, the call is left unchanged. "+
+		"%s should be called after the request body is complete.", name, mask.p.Name, name)
+	p("\n%s", asComment("", comment))
+	pn("func (c *%s) %s(old %s) *%s {", callName, name, body.gotype, callName)
+	pn(" mask, v := gensupport.DiffForPatch(old, c.%s)", body.goname)
+	pn(" if mask != \"\" {")
+	pn("  c.%s = v.(%s)", body.goname, body.gotype)
+	pn("  c.urlParams_.Set(%q, mask)", mask.p.Name)
+	pn(" }")
+	pn(" return c")
+	pn("}")
+}
+
+// generateStream writes the Stream method of a paginated call, which hands
+// the items of each page to a callback as they are decoded from the response.
+func (meth *Method) generateStream(callName, retType string, ptg *pageTokenGenerator, rname string, prop *Property, itemType string) {
+	pn := meth.api.pn
+	field := prop.GoName()
+
+	pn("")
+	pn("// Stream invokes f for each of the %s of all pages of results, starting", field)
+	pn("// with the page selected by the call's page token, if any. Unlike Pages, it")
+	pn("// decodes the %s of a page one at a time as they are read from the", field)
+	pn("// response, so that memory use is bounded by the size of an item rather")
+	pn("// than that of a page.")
+	pn("// A non-nil error returned from f will halt the iteration.")
+	pn("// The provided context supersedes any context provided to the Context method.")
+	pn("func (c *%s) Stream(ctx context.Context, f func(%s) error) error {", callName, itemType)
+	pn(" c.ctx_ = ctx")
+	pn(` defer %s  // reset paging to original point`, ptg.genDeferBody())
+	pn(" for {")
+	pn("  x, err := c.doStream(f)")
+	pn("  if err != nil { return err }")
+	pn(`  if x.%s == "" { return nil }`, rname)
+	pn(ptg.genSet("x." + rname))
+	pn(" }")
+	pn("}")
+
+	pn("")
+	pn("// doStream sends the call and invokes f for each of the %s of the", field)
+	pn("// response. It returns the response, without its %s.", field)
+	pn("func (c *%s) doStream(f func(%s) error) (%s, error) {", callName, itemType, retType)
+	pn(` res, err := c.doRequest("json")`)
+	pn(" if err != nil { return nil, err }")
+	pn(" defer googleapi.CloseBody(res)")
+	pn(" if err := googleapi.CheckResponse(res); err != nil { return nil, err }")
+	pn(" ret := &%s{", strings.TrimPrefix(retType, "*"))
+	pn("  ServerResponse: googleapi.ServerResponse{")
+	pn("   Header: res.Header,")
+	pn("   HTTPStatusCode: res.StatusCode,")
+	pn("  },")
+	pn(" }")
+	pn(" err = gensupport.DecodeResponseStream(ret, res, %q, func(decode func(interface{}) error) error {", prop.p.Name)
+	pn("  var item %s", itemType)
+	pn("  if err := decode(&item); err != nil { return err }")
+	pn("  return f(item)")
+	pn(" })")
+	pn(" if err != nil { return nil, err }")
+	pn(" return ret, nil")
+	pn("}")
+}
+
+// generateIterator writes an iterator over the items in the field of each
+// page of results of the paginated method m, and the Iterator method of its
+// call type that creates it.
+func (meth *Method) generateIterator(callName, retType string, ptg *pageTokenGenerator, rname, field, itemType string) {
+	a := meth.api
+	pn := a.pn
+	itName := a.GetName(strings.TrimSuffix(callName, "Call") + "Iterator")
+
+	pn("")
+	pn("// Iterator returns an iterator over the %s of all pages of results,", field)
+	pn("// starting with the page selected by the call's page token, if any.")
+	pn("// The call must not be used after this.")
+	pn("// The provided context supersedes any context provided to the Context method.")
+	pn("func (c *%s) Iterator(ctx context.Context) *%s {", callName, itName)
+	pn(" c.ctx_ = ctx")
+	pn(" it := &%s{c: c}", itName)
+	pn(" it.pageInfo, it.nextFunc = iterator.NewPageInfo(")
+	pn("  it.fetch,")
+	pn("  func() int { return len(it.items) },")
+	pn("  func() interface{} { b := it.items; it.items = nil; return b })")
+	pn(" it.pageInfo.Token = %s", ptg.genGet())
+	pn(" return it")
+	pn("}")
+
+	pn("")
+	pn("// %s is an iterator over the %s returned by %s.", itName, field, callName)
+	pn("type %s struct {", itName)
+	pn(" c *%s", callName)
+	pn(" items []%s", itemType)
+	pn(" pageInfo *iterator.PageInfo")
+	pn(" nextFunc func() error")
+	pn("")
+	pn(" // Response is the most recent page of results. It is nil until the")
+	pn(" // first page has been fetched.")
+	pn(" Response %s", retType)
+	pn("}")
+
+	pn("")
+	pn("// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.")
+	pn("func (it *%s) PageInfo() *iterator.PageInfo { return it.pageInfo }", itName)
+
+	pn("")
+	pn("// Next returns the next result. Its second return value is iterator.Done if")
+	pn("// there are no more results. Once Next returns Done, all subsequent calls")
+	pn("// will return Done.")
+	pn("func (it *%s) Next() (%s, error) {", itName, itemType)
+	pn(" var item %s", itemType)
+	pn(" if err := it.nextFunc(); err != nil { return item, err }")
+	pn(" item = it.items[0]")
+	pn(" it.items = it.items[1:]")
+	pn(" return item, nil")
+	pn("}")
+
+	pn("")
+	pn("func (it *%s) fetch(pageSize int, pageToken string) (string, error) {", itName)
+	pn(" c := it.c")
+	pn(ptg.genSet("pageToken"))
+	if psp := meth.pageSizeParam(); psp != nil {
+		pn(" if pageSize > 0 { c.%s(int64(pageSize)) }", initialCap(psp.p.Name))
+	}
+	pn(" x, err := c.Do()")
+	pn(` if err != nil { return "", err }`)
+	pn(" it.Response = x")
+	pn(" it.items = append(it.items, x.%s...)", field)
+	pn(" return x.%s, nil", rname)
+	pn("}")
+}
+
+// generateValidate writes the Validate method of the call type of m, which
+// checks the call's parameters against the constraints in the discovery
+// document. Nothing is written if there are no constraints to check.
+func (meth *Method) generateValidate(callName string, args *arguments) {
+	if len(meth.grepParams(func(p *Param) bool { return initialCap(p.p.Name) == "Validate" })) > 0 {
+		return
 	}
+	var checks []string
+	for _, p := range meth.Params() {
+		name := p.p.Name
+		var value, values string
+		switch p.p.Location {
+		case "query":
+			value = fmt.Sprintf("c.urlParams_.Get(%q)", name)
+			values = fmt.Sprintf("c.urlParams_[%q]...", name)
+		case "path":
+			for _, arg := range args.l {
+				if arg.apiname == name && arg.location == "path" {
+					value = arg.exprAsString("c.")
+					values = value
+				}
+			}
+		}
+		if value == "" {
+			continue
+		}
+		if p.p.Required && p.p.Type == "string" {
+			checks = append(checks, fmt.Sprintf("v.Required(%q, %s)", name, value))
+		}
+		if pat := p.p.Pattern; pat != "" && p.p.Type == "string" {
+			if _, err := regexp.Compile(pat); err == nil {
+				checks = append(checks, fmt.Sprintf("v.Pattern(%q, %q, %s)", name, pat, values))
+			}
+		}
+		if len(p.p.Enums) > 0 {
+			checks = append(checks, fmt.Sprintf("v.Enum(%q, %#v, %s)", name, p.p.Enums, values))
+		}
+		if p.p.Minimum != "" || p.p.Maximum != "" {
+			checks = append(checks, fmt.Sprintf("v.Range(%q, %q, %q, %s)", name, p.p.Minimum, p.p.Maximum, values))
+		}
+	}
+	if len(checks) == 0 {
+		return
+	}
+	pn := meth.api.pn
+	pn("\n// Validate checks the parameters of the call against the constraints of")
+	pn("// the API, such as required values, patterns, enums and ranges, without")
+	pn("// sending the call. If any are violated, it returns a")
+	pn("// *googleapi.ValidationError listing every violation.")
+	pn("func (c *%s) Validate() error {", callName)
+	pn(" v := gensupport.NewValidator(%q)", meth.m.ID)
+	for _, check := range checks {
+		pn(" %s", check)
+	}
+	pn(" return v.Err()")
+	pn("}")
 }
 
 // A Field provides methods that describe the characteristics of a Param or Property.
@@ -2249,7 +3980,9 @@ type Field interface {
 	Default() string
 	Enum() ([]string, bool)
 	EnumDescriptions() []string
+	EnumDeprecated() []bool
 	UnfortunateDefault() bool
+	Deprecated() bool
 }
 
 type Param struct {
@@ -2273,6 +4006,14 @@ func (p *Param) EnumDescriptions() []string {
 	return p.p.EnumDescriptions
 }
 
+func (p *Param) EnumDeprecated() []bool {
+	return p.p.EnumDeprecated
+}
+
+func (p *Param) Deprecated() bool {
+	return p.p.Schema.Deprecated
+}
+
 func (p *Param) UnfortunateDefault() bool {
 	// We do not do anything special for Params with unfortunate defaults.
 	return false
@@ -2660,6 +4401,7 @@ func addFieldValueComments(p func(format string, args ...interface{}), field Fie
 
 	if enum, ok := field.Enum(); ok {
 		desc := field.EnumDescriptions()
+		dep := field.EnumDeprecated()
 		lines = append(lines, asComment(indent, "Possible values:"))
 		defval := field.Default()
 		for i, v := range enum {
@@ -2667,6 +4409,9 @@ func addFieldValueComments(p func(format string, args ...interface{}), field Fie
 			if v == defval {
 				more = " (default)"
 			}
+			if len(dep) > i && dep[i] {
+				more += " (deprecated)"
+			}
 			if len(desc) > i && desc[i] != "" {
 				more = more + " - " + desc[i]
 			}
@@ -2683,6 +4428,76 @@ func addFieldValueComments(p func(format string, args ...interface{}), field Fie
 	}
 }
 
+// enumType is a string type whose constants are the values of an enum.
+type enumType struct {
+	base   string        // preferred Go name of the type
+	doc    string        // what the values are for, such as "Instance.State"
+	name   string        // if set, the type is already declared with this name
+	schema *disco.Schema // holds the values and their descriptions
+}
+
+// writeEnum writes the type of e, unless it is already declared, and a
+// constant for each of its values. It returns the name of the type.
+func (a *API) writeEnum(e *enumType) string {
+	name := e.name
+	if name == "" {
+		name = a.GetName(e.base)
+		a.p("\n%s", asComment("", fmt.Sprintf("%s holds the possible values of %s.", name, e.doc)))
+		a.pn("type %s string", name)
+	}
+	es := e.schema
+	a.pn("\nconst (")
+	for i, v := range es.Enums {
+		cname := a.GetName(name + enumValueName(v))
+		var des string
+		if i < len(es.EnumDescriptions) {
+			des = removeMarkdownLinks(es.EnumDescriptions[i])
+		}
+		if des != "" {
+			a.p("%s", asComment("\t", cname+": "+des))
+		}
+		if i < len(es.EnumDeprecated) && es.EnumDeprecated[i] {
+			addDeprecatedComment(a.p, des, "\t", des != "")
+		}
+		a.pn("\t%s %s = %q", cname, name, v)
+	}
+	a.pn(")")
+	return name
+}
+
+// enumValueName returns the suffix of the name of the constant for the
+// enum value v, such as "StateUnspecified" for "STATE_UNSPECIFIED".
+func enumValueName(v string) string {
+	words := strings.FieldsFunc(v, func(r rune) bool {
+		return r >= utf8.RuneSelf || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "Empty"
+	}
+	var buf bytes.Buffer
+	for _, w := range words {
+		if strings.ToUpper(w) == w {
+			w = strings.ToLower(w)
+		}
+		buf.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return buf.String()
+}
+
+// addDeprecatedComment adds a "Deprecated:" paragraph to the doc comment of
+// an element that the discovery document marks as deprecated, unless its
+// description already starts with or has one. blankLine reports whether the
+// comment already has other paragraphs.
+func addDeprecatedComment(p func(format string, args ...interface{}), des, indent string, blankLine bool) {
+	if strings.HasPrefix(strings.TrimSpace(des), "Deprecated:") || strings.Contains(des, "\n\nDeprecated:") {
+		return
+	}
+	if blankLine {
+		p(indent + "//\n")
+	}
+	p("%s", asComment(indent, "Deprecated: This is deprecated in the API and may be removed in a future version."))
+}
+
 // markdownLinkRe is a non-greedy regex meant to find markdown style links. It
 // also captures the name of the link.
 var markdownLinkRe = regexp.MustCompile("([^`]|\\A)(\\[([^\\[]*?)]\\((.*?)\\))([^`]|\\z)")
@@ -8,12 +8,16 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
-	"google.golang.org/api/google-api-go-generator/internal/disco"
+	"google.golang.org/api/internal/disco"
 	"google.golang.org/api/internal/version"
 )
 
@@ -21,28 +25,42 @@ var updateGolden = flag.Bool("update_golden", false, "If true, causes TestAPIs t
 
 func TestAPIs(t *testing.T) {
 	*copyrightYear = "YEAR"
+	defer func(old string) { *typedFormats = old }(*typedFormats)
+	*typedFormats = "typedformats:v1"
+	defer func(old string) { *interfaces = old }(*interfaces)
+	*interfaces = "healthcare:v1beta1"
+	defer func(old string) { *allowlist = old }(*allowlist)
+	*allowlist = "allowlist.shelves.list,allowlist.shelves.books"
 
 	names := []string{
+		"allowlist",
 		"any",
 		"arrayofarray-1",
 		"arrayofenum",
 		"arrayofmapofobjects",
 		"arrayofmapofstrings",
+		"batch-param",
 		"blogger-3",
+		"computeops",
+		"deprecated",
 		"floats",
 		"getwithoutbody",
 		"http-body",
 		"json-body",
+		"media-download",
+		"media-upload",
 		"mapofany",
 		"mapofarrayofobjects",
 		"mapofint64strings",
 		"mapofobjects",
 		"mapofstrings-1",
+		"outputonly",
 		"param-rename",
 		"quotednum",
 		"repeated",
 		"required-query",
 		"resource-named-service", // appengine/v1/appengine-api.json
+		"typedformats",
 		"unfortunatedefaults",
 		"variants",
 		"wrapnewlines",
@@ -282,3 +300,146 @@ func TestAsComment_LongLink(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 }
+
+func TestResourceNameCollections(t *testing.T) {
+	for _, test := range []struct {
+		path, flatPath string
+		want           []string
+	}{
+		{"v1/{+name}", "v1/projects/{projectsId}/locations/{locationsId}/instances/{instancesId}", []string{"projects", "locations", "instances"}},
+		{"v1/{+parent}/instances", "v1/projects/{projectsId}/instances", []string{"projects"}},
+		{"v1/{+name}:cancel", "v1/projects/{projectsId}/operations/{operationsId}:cancel", []string{"projects", "operations"}},
+		{"v1/{+name}", "", nil},
+		{"v1/{name}", "v1/{name}", nil},
+		{"v1/{+name}", "v1/{v1Id}", nil},
+		{"v1/{+name}", "v1/projects/{projectsId}/{projectsId1}", nil},
+		{"v1/{+parent}/fhir/{+type}", "v1/projects/{projectsId}/fhir/{fhirId}", nil},
+	} {
+		got := resourceNameCollections(&disco.Method{Path: test.path, FlatPath: test.flatPath})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("resourceNameCollections(%q, %q) = %q, want %q", test.path, test.flatPath, got, test.want)
+		}
+	}
+}
+
+func TestResourceNameBases(t *testing.T) {
+	forms := [][]string{
+		{"projects", "jobs"},
+		{"projects", "locations", "jobs"},
+		{"projects", "locations"},
+		{"jobs"},
+		{"organizations", "locations", "jobs"},
+	}
+	got := resourceNameBases(forms)
+	want := []string{"ProjectJobName", "ProjectLocationJobName", "LocationName", "JobName", "OrganizationLocationJobName"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resourceNameBases(%q) = %q, want %q", forms, got, want)
+	}
+}
+
+func TestSingular(t *testing.T) {
+	for in, want := range map[string]string{
+		"projects":        "project",
+		"policies":        "policy",
+		"addresses":       "address",
+		"boxes":           "box",
+		"batches":         "batch",
+		"billingAccounts": "billingAccount",
+		"access":          "access",
+		"data":            "data",
+	} {
+		if got := singular(in); got != want {
+			t.Errorf("singular(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEnumValueName(t *testing.T) {
+	for in, want := range map[string]string{
+		"RUNNING":           "Running",
+		"STATE_UNSPECIFIED": "StateUnspecified",
+		"noAcl":             "NoAcl",
+		"full":              "Full",
+		"image/png":         "ImagePng",
+		"1080p":             "1080p",
+		"":                  "Empty",
+	} {
+		if got := enumValueName(in); got != want {
+			t.Errorf("enumValueName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAllowlistUnmatched(t *testing.T) {
+	defer func(old string) { *allowlist = old }(*allowlist)
+	*allowlist = "allowlist.shelves.list,allowlist.shelves.missing"
+	api, err := apiFromFile(filepath.Join("testdata", "allowlist.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.GenerateCode(); err == nil || !strings.Contains(err.Error(), "allowlist.shelves.missing") {
+		t.Errorf("got error %v, want one naming allowlist.shelves.missing", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	decls := func(t *testing.T, splitFiles bool) map[string]string {
+		defer func(old bool) { *split = old }(*split)
+		*split = splitFiles
+		api, err := apiFromFile(filepath.Join("testdata", "blogger-3.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.GenerateCode(); err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]string{} // file name, by declared name
+		for _, f := range api.files {
+			name := f.fileName("blogger-gen.go")
+			file, err := parser.ParseFile(token.NewFileSet(), name, f.code, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range file.Decls {
+				switch d := d.(type) {
+				case *ast.FuncDecl:
+					key := d.Name.Name
+					if d.Recv != nil {
+						key = fmt.Sprintf("%s.%s", pointerTypeName(d.Recv.List[0].Type), key)
+					}
+					m[key] = name
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						if ts, ok := spec.(*ast.TypeSpec); ok {
+							m[ts.Name.Name] = name
+						}
+					}
+				}
+			}
+		}
+		return m
+	}
+	whole := decls(t, false)
+	parts := decls(t, true)
+	if len(whole) != len(parts) {
+		t.Errorf("got %d declarations in split files, want %d", len(parts), len(whole))
+	}
+	for name := range whole {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("%s is missing from the split files", name)
+		}
+	}
+	for name, want := range map[string]string{
+		"NewService":           "blogger-gen.go",
+		"BlogsService":         "blogger-gen.go",
+		"Blog":                 "blogger-schemas-gen.go",
+		"Blog.MarshalJSON":     "blogger-schemas-gen.go",
+		"BlogsGetCall":         "blogger-blogs-gen.go",
+		"BlogsGetCall.Do":      "blogger-blogs-gen.go",
+		"PostsListCall.Stream": "blogger-posts-gen.go",
+	} {
+		if got := parts[name]; got != want {
+			t.Errorf("%s is in %q, want %q", name, got, want)
+		}
+	}
+}
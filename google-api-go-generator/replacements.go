@@ -45,3 +45,13 @@ var replacementPackage deprecatedPkgs = map[string]string{
 	"vision":            "cloud.google.com/go/vision/apiv1",
 	"storage":           "cloud.google.com/go/storage",
 }
+
+// shutDownPackage is a map from an API package name to the reason the API
+// is no longer available. If an API appears in this map, its package doc
+// comment gets a "Deprecated:" paragraph with the reason.
+var shutDownPackage deprecatedPkgs = map[string]string{
+	"fusiontables": "The Fusion Tables API has been shut down.",
+	"plus":         "The Google+ API has been shut down.",
+	"plusdomains":  "The Google+ Domains API has been shut down.",
+	"urlshortener": "The URL Shortener API has been shut down. Use Firebase Dynamic Links instead.",
+}
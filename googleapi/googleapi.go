@@ -15,6 +15,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/api/internal/third_party/uritemplates"
 )
@@ -121,6 +123,41 @@ func (e *Error) Error() string {
 	return buf.String()
 }
 
+// A ValidationError is returned by the Validate method of a call whose
+// parameters violate the constraints that the API places on them. It lists
+// every violation.
+type ValidationError struct {
+	// Method is the ID of the API method, such as "drive.files.list".
+	Method string
+	// Errors describe the violations, in the order of the method's
+	// parameters.
+	Errors []ParamError
+}
+
+// A ParamError describes a parameter value that violates a constraint.
+type ParamError struct {
+	// Param is the name of the parameter in the API, such as "pageSize".
+	Param string
+	// Value is the offending value of the parameter, formatted as it would
+	// be sent.
+	Value string
+	// Message describes the constraint that is violated, such as
+	// "must be at most 1000".
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "googleapi: invalid parameters for %s: ", e.Method)
+	for i, pe := range e.Errors {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		fmt.Fprintf(&buf, "%s %q %s", pe.Param, pe.Value, pe.Message)
+	}
+	return buf.String()
+}
+
 type errorReply struct {
 	Error *Error `json:"error"`
 }
@@ -206,6 +243,61 @@ func (wrap MarshalStyle) JSONReader(v interface{}) (io.Reader, error) {
 // The remaining usable pieces of resumable uploads is exposed in each auto-generated API.
 type ProgressUpdater func(current, total int64)
 
+// UploadProgress describes the progress of a media upload.
+type UploadProgress struct {
+	// BytesRead is the number of bytes of the media read from its source.
+	// Media uploaded in chunks is read ahead of what has been sent.
+	BytesRead int64
+	// BytesCommitted is the number of bytes of the media that the server has
+	// acknowledged. Media uploaded in a single request is acknowledged when
+	// the request completes.
+	BytesCommitted int64
+	// Total is the size of the media, or -1 if it is not known yet. The size
+	// of media passed to Media is known once all of it has been read.
+	Total int64
+	// Chunk is the number of the chunk being uploaded, starting at 0. Media
+	// uploaded in a single request is a single chunk.
+	Chunk int
+	// Retries is the number of times the current chunk has been retried.
+	Retries int
+	// Rate is the average rate at which the media has been sent since the
+	// upload started, in bytes per second.
+	Rate float64
+	// ETA is the estimated time until all of the media is sent, or zero if
+	// it is not known.
+	ETA time.Duration
+	// Done reports whether the upload is complete.
+	Done bool
+}
+
+// UploadProgressUpdater is a function that is called with the progress of a
+// media upload when the upload starts, as the media is read and sent, when a
+// chunk is committed or retried, and when the upload is complete. It is not
+// called concurrently, and should return quickly.
+type UploadProgressUpdater func(*UploadProgress)
+
+// An UploadSession describes a resumable upload in progress. It can be saved,
+// for instance as JSON, and passed to the ResumeUpload method of a call to
+// finish the upload later, possibly in another process.
+type UploadSession struct {
+	// URI is the session URI returned by the server when the upload started.
+	URI string `json:"uri"`
+	// Offset is the number of bytes of the media that the server had
+	// received when the session was last updated. When an upload is resumed,
+	// the server is asked for the number of bytes it has, so this is only
+	// informational.
+	Offset int64 `json:"offset"`
+	// ChunkSize is the size of the chunks in which the media is uploaded.
+	ChunkSize int `json:"chunkSize"`
+	// MediaType is the media type of the upload, such as "image/png".
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+// UploadSessionUpdater is a function that is called with the session of a
+// resumable upload when the upload starts and after every chunk, so that the
+// session can be saved.
+type UploadSessionUpdater func(*UploadSession)
+
 // MediaOption defines the interface for setting media options.
 type MediaOption interface {
 	setOptions(o *MediaOptions)
@@ -245,12 +337,190 @@ func ChunkSize(size int) MediaOption {
 	return chunkSizeOption(size)
 }
 
+type readAheadOption bool
+
+func (ra readAheadOption) setOptions(o *MediaOptions) {
+	o.ReadAhead = bool(ra)
+}
+
+// ReadAhead returns a MediaOption which makes uploads in separate chunks read
+// the next chunk of the media while the current one is being sent, so that
+// reading the media and sending it overlap. This uses memory for two chunks.
+// The media is no longer read once the call's Do method returns, though Do
+// may wait for a read that is in progress to finish.
+func ReadAhead() MediaOption {
+	return readAheadOption(true)
+}
+
+// A ChunkPool holds the buffers in which the chunks of uploads are read, so
+// that they can be reused by later uploads. It must be safe for concurrent
+// use.
+type ChunkPool interface {
+	// Get returns an empty buffer with a capacity of at least size bytes.
+	Get(size int) []byte
+	// Put returns a buffer obtained from Get to the pool.
+	Put(buf []byte)
+}
+
+// NewChunkPool returns a ChunkPool that keeps buffers in a sync.Pool for
+// each buffer size.
+func NewChunkPool() ChunkPool {
+	return &chunkPool{}
+}
+
+type chunkPool struct {
+	pools sync.Map // buffer capacity -> *sync.Pool
+}
+
+func (p *chunkPool) Get(size int) []byte {
+	if sp, ok := p.pools.Load(size); ok {
+		if buf, ok := sp.(*sync.Pool).Get().(*[]byte); ok {
+			return (*buf)[:0]
+		}
+	}
+	return make([]byte, 0, size)
+}
+
+func (p *chunkPool) Put(buf []byte) {
+	sp, _ := p.pools.LoadOrStore(cap(buf), new(sync.Pool))
+	sp.(*sync.Pool).Put(&buf)
+}
+
+type chunkPoolOption struct{ pool ChunkPool }
+
+func (cp chunkPoolOption) setOptions(o *MediaOptions) {
+	o.ChunkPool = cp.pool
+}
+
+// ChunkBufferPool returns a MediaOption which makes uploads in separate
+// chunks take their chunk buffers from pool, and return them to it once the
+// upload is complete.
+func ChunkBufferPool(pool ChunkPool) MediaOption {
+	return chunkPoolOption{pool}
+}
+
+type adaptiveChunkSizeOption struct {
+	target  time.Duration
+	maxSize int
+}
+
+func (ac adaptiveChunkSizeOption) setOptions(o *MediaOptions) {
+	size := ac.maxSize
+	if size < MinUploadChunkSize {
+		size = MinUploadChunkSize
+	}
+	if size%MinUploadChunkSize != 0 {
+		size += MinUploadChunkSize - (size % MinUploadChunkSize)
+	}
+	o.ChunkUploadTime = ac.target
+	o.MaxChunkSize = size
+}
+
+// AdaptiveChunkSize returns a MediaOption which adapts the chunk size of
+// uploads in separate chunks to the measured upload throughput, so that each
+// chunk takes about target to send. The first chunk has the size set by
+// ChunkSize. Later chunks are multiples of 256K, no smaller than
+// MinUploadChunkSize and no larger than maxSize rounded up to a multiple of
+// 256K.
+func AdaptiveChunkSize(target time.Duration, maxSize int) MediaOption {
+	return adaptiveChunkSizeOption{target, maxSize}
+}
+
+// A Checksum is a set of checksum types of media.
+type Checksum int
+
+const (
+	// CRC32C is the CRC-32 checksum with the Castagnoli polynomial.
+	CRC32C Checksum = 1 << iota
+	// MD5 is the MD5 hash.
+	MD5
+)
+
+type checksumOption Checksum
+
+func (co checksumOption) setOptions(o *MediaOptions) {
+	o.Checksums = Checksum(co)
+}
+
+// VerifyChecksums returns a MediaOption which computes the given checksums of
+// the media while it is uploaded, and sends them to the server in the
+// X-Goog-Hash header of the request with the end of the media. The call fails
+// if the checksums the server reports for the uploaded media do not match.
+// When the media is uploaded without chunking (see ChunkSize), the checksums
+// are only verified, not sent.
+func VerifyChecksums(c Checksum) MediaOption {
+	return checksumOption(c)
+}
+
+type chunkRetryDeadlineOption time.Duration
+
+func (cd chunkRetryDeadlineOption) setOptions(o *MediaOptions) {
+	o.ChunkRetryDeadline = time.Duration(cd)
+}
+
+// ChunkRetryDeadline returns a MediaOption which sets how long the upload of
+// a chunk is retried before the upload fails. The default is 32 seconds.
+func ChunkRetryDeadline(d time.Duration) MediaOption {
+	return chunkRetryDeadlineOption(d)
+}
+
+type chunkRetryBackoffOption struct {
+	initial, max time.Duration
+	multiplier   float64
+}
+
+func (cb chunkRetryBackoffOption) setOptions(o *MediaOptions) {
+	o.ChunkRetryInitialDelay = cb.initial
+	o.ChunkRetryMaxDelay = cb.max
+	o.ChunkRetryMultiplier = cb.multiplier
+}
+
+// ChunkRetryBackoff returns a MediaOption which sets the delays between the
+// retries of the upload of a chunk. The first delay is initial, and each
+// delay grows by multiplier up to max. Zero values select the defaults: an
+// initial delay of 100ms, a maximum delay of 30s and a multiplier of 2.
+func ChunkRetryBackoff(initial, max time.Duration, multiplier float64) MediaOption {
+	return chunkRetryBackoffOption{initial, max, multiplier}
+}
+
+type chunkRetryFuncOption func(status int, err error) bool
+
+func (cf chunkRetryFuncOption) setOptions(o *MediaOptions) {
+	o.ChunkShouldRetry = cf
+}
+
+// ChunkRetryFunc returns a MediaOption which sets the function that decides
+// whether the upload of a chunk is retried after it failed with a response
+// with the given status code, or with err, in which case status is zero. It
+// replaces the default, which retries 5xx and 429 responses and temporary
+// network errors.
+func ChunkRetryFunc(f func(status int, err error) bool) MediaOption {
+	return chunkRetryFuncOption(f)
+}
+
 // MediaOptions stores options for customizing media upload.  It is not used by developers directly.
 type MediaOptions struct {
 	ContentType           string
 	ForceEmptyContentType bool
 
 	ChunkSize int
+
+	ReadAhead bool
+	ChunkPool ChunkPool
+	// ChunkUploadTime is the target time to send a chunk in. If it is zero,
+	// the chunk size does not change.
+	ChunkUploadTime time.Duration
+	MaxChunkSize    int
+
+	Checksums Checksum
+
+	// The options below configure how the upload of a chunk is retried.
+	// Zero values select the defaults.
+	ChunkRetryDeadline     time.Duration
+	ChunkRetryInitialDelay time.Duration
+	ChunkRetryMaxDelay     time.Duration
+	ChunkRetryMultiplier   float64
+	ChunkShouldRetry       func(status int, err error) bool
 }
 
 // ProcessMediaOptions stores options from opts in a MediaOptions.
@@ -418,3 +688,59 @@ type traceTok string
 func (t traceTok) Get() (string, string) { return "trace", "token:" + string(t) }
 
 // TODO: Fields too
+
+// WaitOptions configure how the generated Wait methods poll a long-running
+// operation. The delay between polls starts at InitialDelay and grows by
+// Multiplier after each poll, up to MaxDelay. A nil *WaitOptions, or a zero
+// field, selects the default.
+type WaitOptions struct {
+	// InitialDelay is the delay before the first poll. The default is 1s.
+	InitialDelay time.Duration
+	// MaxDelay is the maximum delay between polls. The default is 1m.
+	MaxDelay time.Duration
+	// Multiplier is the factor by which the delay grows after each poll.
+	// The default is 1.5.
+	Multiplier float64
+}
+
+// RetryPolicy selects which calls a RetryConfig retries.
+type RetryPolicy int
+
+const (
+	// RetryIdempotent retries only calls whose HTTP method is idempotent:
+	// GET, HEAD, OPTIONS, PUT and DELETE. It is the default.
+	RetryIdempotent RetryPolicy = iota
+	// RetryAlways retries every call, including POST and PATCH calls that
+	// may have taken effect before they failed.
+	RetryAlways
+	// RetryNever disables retries.
+	RetryNever
+)
+
+// RetryConfig configures how failed API calls are retried. It is set for a
+// single call with the call's Retryer method, or for all the calls of a
+// service with option.WithRetryConfig. A call is retried only if its request
+// body can be sent again.
+//
+// Zero fields select the defaults.
+type RetryConfig struct {
+	// Codes are the HTTP status codes of the responses to retry. The default
+	// is 408, 429, 500, 502, 503 and 504. Temporary network errors are
+	// always retried.
+	Codes []int
+	// MaxAttempts is the maximum number of times a call is sent, including
+	// the first. The default is 5. Retries also stop when the call's
+	// context is done.
+	MaxAttempts int
+	// Policy selects the calls to retry.
+	Policy RetryPolicy
+
+	// InitialDelay is the delay before the first retry. The default is
+	// 100ms.
+	InitialDelay time.Duration
+	// MaxDelay is the maximum delay between retries. The default is 30s.
+	MaxDelay time.Duration
+	// Multiplier is the factor by which the delay grows after each retry.
+	// The default is 2.
+	Multiplier float64
+}
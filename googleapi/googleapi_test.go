@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type ExpandTest struct {
@@ -401,3 +402,36 @@ func TestRoundChunkSize(t *testing.T) {
 		}
 	}
 }
+
+func TestRoundMaxChunkSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   int
+		want int
+	}{
+		{0, 256 * 1024},
+		{256*1024 + 1, 2 * 256 * 1024},
+		{16 * 1024 * 1024, 16 * 1024 * 1024},
+	} {
+		mo := &MediaOptions{}
+		AdaptiveChunkSize(time.Second, tc.in).setOptions(mo)
+		if got := mo.MaxChunkSize; got != tc.want {
+			t.Errorf("rounding max chunk size %d: got: %v; want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestChunkPool(t *testing.T) {
+	p := NewChunkPool()
+	buf := p.Get(10)
+	if len(buf) != 0 || cap(buf) < 10 {
+		t.Fatalf("Get(10): got len %d, cap %d", len(buf), cap(buf))
+	}
+	p.Put(append(buf, "abc"...))
+	// sync.Pool may drop the buffer, so only the size of the result can be checked.
+	if buf := p.Get(10); len(buf) != 0 || cap(buf) < 10 {
+		t.Errorf("second Get(10): got len %d, cap %d", len(buf), cap(buf))
+	}
+	if buf := p.Get(20); cap(buf) < 20 {
+		t.Errorf("Get(20): got cap %d", cap(buf))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"strconv"
+	"strings"
 )
 
 // Int64s is a slice of int64s that marshal as quoted strings in JSON.
@@ -169,6 +170,35 @@ func (m *RawMessage) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// FieldMask is a list of field paths, such as "name" or "config.displayName".
+// It is encoded in JSON as a single comma-separated string, as specified for
+// fields with the "google-fieldmask" format.
+type FieldMask []string
+
+// String returns the paths of m separated by commas.
+func (m FieldMask) String() string {
+	return strings.Join(m, ",")
+}
+
+// MarshalJSON encodes m as a JSON string.
+func (m FieldMask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON sets *m to the paths in the JSON string data.
+func (m *FieldMask) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*m = FieldMask{}
+		return nil
+	}
+	*m = strings.Split(s, ",")
+	return nil
+}
+
 /*
  * Helper routines for simplifying the creation of optional fields of basic type.
  */
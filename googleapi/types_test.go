@@ -66,3 +66,29 @@ func TestRawMessageUnmarshal(t *testing.T) {
 		t.Errorf("Unmarshal([]byte(%q), &m); m = %q; want %q", want, string(m), want)
 	}
 }
+
+func TestFieldMask(t *testing.T) {
+	for _, test := range []struct {
+		m    FieldMask
+		json string
+	}{
+		{FieldMask{}, `""`},
+		{FieldMask{"name"}, `"name"`},
+		{FieldMask{"name", "config.displayName"}, `"name,config.displayName"`},
+	} {
+		b, err := json.Marshal(test.m)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != test.json {
+			t.Errorf("Marshal(%q) = %s; want %s", test.m, b, test.json)
+		}
+		var m FieldMask
+		if err := json.Unmarshal([]byte(test.json), &m); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !reflect.DeepEqual(m, test.m) {
+			t.Errorf("Unmarshal(%s) = %q; want %q", test.json, m, test.m)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -23,6 +24,7 @@ type Document struct {
 	MTLSRootURL       string             `json:"mtlsRootUrl"`
 	ServicePath       string             `json:"servicePath"`
 	BasePath          string             `json:"basePath"`
+	BatchPath         string             `json:"batchPath"`
 	DocumentationLink string             `json:"documentationLink"`
 	Auth              Auth               `json:"auth"`
 	Features          []string           `json:"features"`
@@ -136,16 +138,37 @@ type Schema struct {
 	Ref                  string  `json:"$ref"`
 	Default              string
 	Pattern              string
+	Minimum              string
+	Maximum              string
 	Enums                []string `json:"enum"`
 	// Google extensions to JSON Schema
 	EnumDescriptions []string
+	EnumDeprecated   []bool // parallel to Enums
 	Variant          *Variant
+	Deprecated       bool
+	Annotations      Annotations
 
 	RefSchema *Schema `json:"-"` // Schema referred to by $ref
 	Name      string  `json:"-"` // Schema name, if top level
 	Kind      Kind    `json:"-"`
+
+	// Set from the description, which marks fields in prose.
+	OutputOnly     bool `json:"-"` // "Output only." or "[Output Only]": set by the server
+	AlwaysRequired bool `json:"-"` // "Required." or "[Required]": required in all requests
+}
+
+// Annotations holds the annotations of a schema property.
+type Annotations struct {
+	// Required holds the IDs of the methods whose requests must set the
+	// property.
+	Required []string
 }
 
+var (
+	outputOnlyRE = regexp.MustCompile(`(?i)^\s*(\[output[ -]only\]|output[ -]only[.:,])`)
+	requiredRE   = regexp.MustCompile(`^\s*(\[Required\]|Required[.:])`)
+)
+
 type Variant struct {
 	Discriminant string
 	Map          []*VariantMapItem
@@ -170,6 +193,8 @@ func (s *Schema) init(topLevelSchemas map[string]*Schema) error {
 	if err != nil {
 		return err
 	}
+	s.OutputOnly = outputOnlyRE.MatchString(s.Description)
+	s.AlwaysRequired = requiredRE.MatchString(s.Description)
 	if s.Kind == ArrayKind && s.ItemSchema == nil {
 		return fmt.Errorf("schema %+v: array does not have items", s)
 	}
@@ -356,18 +381,21 @@ func (ml *MethodList) UnmarshalJSON(data []byte) error {
 
 // A Method holds information about a resource method.
 type Method struct {
-	Name                  string
-	ID                    string
-	Path                  string
-	HTTPMethod            string
-	Description           string
-	Parameters            ParameterList
-	ParameterOrder        []string
-	Request               *Schema
-	Response              *Schema
-	Scopes                []string
-	MediaUpload           *MediaUpload
-	SupportsMediaDownload bool
+	Name                    string
+	ID                      string
+	Path                    string
+	FlatPath                string // Path with each {+param} expanded to its segments
+	HTTPMethod              string
+	Description             string
+	Parameters              ParameterList
+	ParameterOrder          []string
+	Request                 *Schema
+	Response                *Schema
+	Scopes                  []string
+	MediaUpload             *MediaUpload
+	SupportsMediaDownload   bool
+	UseMediaDownloadService bool // media is downloaded from the /download path
+	Deprecated              bool
 
 	JSONMap map[string]interface{} `json:"-"`
 }
@@ -33,6 +33,7 @@ func TestDocument(t *testing.T) {
 		RootURL:           "https://www.googleapis.com/",
 		ServicePath:       "storage/v1/",
 		BasePath:          "/storage/v1/",
+		BatchPath:         "batch",
 		DocumentationLink: "https://developers.google.com/storage/docs/json_api/",
 		Auth: Auth{
 			OAuth2Scopes: []Scope{
@@ -77,12 +78,24 @@ func TestDocument(t *testing.T) {
 							},
 						},
 					}},
-					{"id", stringSchema},
+					{"id", &Schema{
+						Type:        "string",
+						Kind:        SimpleKind,
+						Description: "Output only. The ID of the bucket.",
+						OutputOnly:  true,
+					}},
 					{"kind", &Schema{
 						Type:    "string",
 						Kind:    SimpleKind,
 						Default: "storage#bucket",
 					}},
+					{"name", &Schema{
+						Type:           "string",
+						Kind:           SimpleKind,
+						Description:    "Required. The name of the bucket.",
+						Annotations:    Annotations{Required: []string{"storage.buckets.insert"}},
+						AlwaysRequired: true,
+					}},
 				},
 			},
 			"Buckets": {
@@ -134,8 +147,10 @@ func TestDocument(t *testing.T) {
 						Name:        "get",
 						ID:          "storage.buckets.get",
 						Path:        "b/{bucket}",
+						FlatPath:    "b/{bucket}",
 						HTTPMethod:  "GET",
 						Description: "d",
+						Deprecated:  true,
 						Parameters: ParameterList{
 							&Parameter{
 								Name: "bucket",
@@ -148,8 +163,9 @@ func TestDocument(t *testing.T) {
 							&Parameter{
 								Name: "ifMetagenerationMatch",
 								Schema: Schema{
-									Type:   "string",
-									Format: "int64",
+									Type:       "string",
+									Format:     "int64",
+									Deprecated: true,
 								},
 								Location: "query",
 							},
@@ -162,6 +178,7 @@ func TestDocument(t *testing.T) {
 										"Include all properties.",
 										"Omit owner, acl and defaultObjectAcl properties.",
 									},
+									EnumDeprecated: []bool{false, true},
 								},
 								Location: "query",
 							},
@@ -175,7 +192,8 @@ func TestDocument(t *testing.T) {
 							"https://www.googleapis.com/auth/devstorage.read_only",
 							"https://www.googleapis.com/auth/devstorage.read_write",
 						},
-						SupportsMediaDownload: true,
+						SupportsMediaDownload:   true,
+						UseMediaDownloadService: true,
 						MediaUpload: &MediaUpload{
 							Accept:  []string{"application/octet-stream"},
 							MaxSize: "1GB",
@@ -264,6 +282,32 @@ func TestSchemaErrors(t *testing.T) {
 	}
 }
 
+func TestSchemaMarkers(t *testing.T) {
+	for _, test := range []struct {
+		des                        string
+		outputOnly, alwaysRequired bool
+	}{
+		{"Output only. Time the instance was created.", true, false},
+		{"[Output Only] Creation timestamp.", true, false},
+		{"Output-only. The state.", true, false},
+		{"Required. The display name.", false, true},
+		{"[Required] The zone.", false, true},
+		{"The name. Required.", false, false},
+		{"Required fields are listed below.", false, false},
+		{"Output only fields are ignored.", false, false},
+		{"Outputs of the job.", false, false},
+	} {
+		s := &Schema{Type: "string", Description: test.des}
+		if err := s.init(nil); err != nil {
+			t.Fatal(err)
+		}
+		if s.OutputOnly != test.outputOnly || s.AlwaysRequired != test.alwaysRequired {
+			t.Errorf("%q: got OutputOnly=%t, AlwaysRequired=%t, want %t, %t",
+				test.des, s.OutputOnly, s.AlwaysRequired, test.outputOnly, test.alwaysRequired)
+		}
+	}
+}
+
 func TestErrorDoc(t *testing.T) {
 	bytes, err := ioutil.ReadFile("testdata/error.json")
 	if err != nil {
@@ -0,0 +1,351 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Batch combines several API calls into a single multipart/mixed HTTP
+// request. It is used by the generated Batch types and is not used by
+// developers directly.
+//
+// Each call is added as an operation that sends exactly one request with the
+// *http.Client it is given. That client does not talk to the network: it
+// captures the request, and the response is supplied from the corresponding
+// part of the batch response once Do has sent the combined request. This lets
+// the generated Do methods build requests and decode responses exactly as
+// they do outside of a batch.
+type Batch struct {
+	// Client is used to send the combined request.
+	Client *http.Client
+	// URL is the batch endpoint of the API, such as
+	// "https://www.googleapis.com/batch/drive/v3".
+	URL string
+	// Header holds headers to send with the combined request.
+	Header http.Header
+
+	mu   sync.Mutex // guards ops and sent
+	ops  []func(context.Context, *http.Client)
+	sent bool
+}
+
+// Add queues op in b. When b is sent, op is called with a client whose
+// requests become parts of the combined request. op must send at most one
+// request with the client.
+func (b *Batch) Add(op func(ctx context.Context, client *http.Client)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ops = append(b.ops, op)
+}
+
+// Len returns the number of operations queued in b.
+func (b *Batch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.ops)
+}
+
+// Do sends the requests of all queued operations in a single HTTP request
+// and returns once every operation has completed. It returns a non-nil error
+// only if the combined request could not be sent or its response could not be
+// read, in which case every operation also fails. Errors from individual
+// parts are seen only by their operations. A Batch may only be sent once.
+func (b *Batch) Do(ctx context.Context) error {
+	b.mu.Lock()
+	if b.sent {
+		b.mu.Unlock()
+		return errors.New("gensupport: batch already sent")
+	}
+	b.sent = true
+	ops := b.ops
+	b.mu.Unlock()
+	if len(ops) == 0 {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	parts := make([]*batchPart, len(ops))
+	for i, op := range ops {
+		p := newBatchPart()
+		parts[i] = p
+		wg.Add(1)
+		go func(op func(context.Context, *http.Client)) {
+			defer wg.Done()
+			defer close(p.done)
+			op(ctx, &http.Client{Transport: p})
+		}(op)
+	}
+
+	// Wait for each operation to either send its request, or to give up
+	// before sending one (for instance, because of an invalid header).
+	reqs := make([]*http.Request, len(parts))
+	n := 0
+	for i, p := range parts {
+		select {
+		case reqs[i] = <-p.reqc:
+			n++
+		case <-p.done:
+		}
+	}
+	if n == 0 {
+		// Every operation gave up, so there is nothing to send.
+		wg.Wait()
+		return nil
+	}
+
+	resps, err := b.send(ctx, reqs)
+	for i, p := range parts {
+		if reqs[i] == nil {
+			continue
+		}
+		switch {
+		case err != nil:
+			p.respc <- failedBatchResult(err, reqs[i])
+		case resps[i] == nil:
+			p.respc <- batchResult{err: fmt.Errorf("gensupport: batch response is missing part %d", i+1)}
+		default:
+			p.respc <- batchResult{resp: resps[i]}
+		}
+	}
+	wg.Wait()
+	return err
+}
+
+// send sends reqs as a single multipart/mixed request and returns the
+// response for each of them, indexed as reqs. Nil requests are skipped.
+func (b *Batch) send(ctx context.Context, reqs []*http.Request) ([]*http.Response, error) {
+	body, ctype, err := encodeBatchRequests(reqs)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", b.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range b.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", ctype)
+	res, err := SendRequest(ctx, b.Client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	return decodeBatchResponses(res, reqs)
+}
+
+// encodeBatchRequests writes each non-nil request in reqs as an
+// application/http part of a multipart/mixed body. The Content-ID of each
+// part is its 1-based index in reqs.
+func encodeBatchRequests(reqs []*http.Request) (body *bytes.Buffer, ctype string, err error) {
+	body = new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	for i, req := range reqs {
+		if req == nil {
+			continue
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", "application/http")
+		h.Set("Content-Transfer-Encoding", "binary")
+		h.Set("Content-ID", fmt.Sprintf("<%d>", i+1))
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeBatchRequest(w, req); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, "multipart/mixed; boundary=" + mw.Boundary(), nil
+}
+
+// writeBatchRequest writes req in HTTP/1.1 wire format, using a relative
+// request URI as expected by the batch endpoint.
+func writeBatchRequest(w io.Writer, req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	if err := req.Header.Write(bw); err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(bw, "Content-Length: %d\r\n", len(body))
+	}
+	bw.WriteString("\r\n")
+	bw.Write(body)
+	return bw.Flush()
+}
+
+// decodeBatchResponses reads the multipart/mixed body of res and returns the
+// response in each part, indexed as reqs. Parts are matched to requests by
+// their "response-N" Content-ID, or by position if they have none.
+func decodeBatchResponses(res *http.Response, reqs []*http.Request) ([]*http.Response, error) {
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("gensupport: bad batch response Content-Type: %v", err)
+	}
+	if mediaType != "multipart/mixed" {
+		return nil, fmt.Errorf("gensupport: batch response has Content-Type %q, want multipart/mixed", mediaType)
+	}
+	// Positions of the sent requests, used when a part has no Content-ID.
+	var sent []int
+	for i, req := range reqs {
+		if req != nil {
+			sent = append(sent, i)
+		}
+	}
+	resps := make([]*http.Response, len(reqs))
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	for n := 0; ; n++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return resps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		i, ok := batchPartIndex(part.Header.Get("Content-ID"))
+		if !ok {
+			if n >= len(sent) {
+				return nil, fmt.Errorf("gensupport: batch response has more than %d parts", len(sent))
+			}
+			i = sent[n]
+		}
+		if i < 0 || i >= len(reqs) || reqs[i] == nil {
+			return nil, fmt.Errorf("gensupport: batch response has unexpected Content-ID %q", part.Header.Get("Content-ID"))
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(part), reqs[i])
+		if err != nil {
+			return nil, err
+		}
+		// The next part can't be read until this one is consumed, so buffer the body.
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resps[i] = resp
+	}
+}
+
+// batchPartIndex returns the 0-based request index encoded in a response
+// part's Content-ID, such as "<response-3>".
+func batchPartIndex(contentID string) (int, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(contentID, "<"), ">")
+	if !strings.HasPrefix(id, "response-") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(id, "response-"))
+	if err != nil {
+		return 0, false
+	}
+	return n - 1, true
+}
+
+type batchResult struct {
+	resp *http.Response
+	err  error
+}
+
+// batchPart is the http.RoundTripper given to a single batch operation. It
+// hands the operation's request to the batch and waits for its response.
+type batchPart struct {
+	reqc  chan *http.Request
+	respc chan batchResult
+	done  chan struct{} // closed when the operation returns
+
+	mu   sync.Mutex
+	used bool
+}
+
+func newBatchPart() *batchPart {
+	return &batchPart{
+		reqc:  make(chan *http.Request, 1),
+		respc: make(chan batchResult, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+func (p *batchPart) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.mu.Lock()
+	used := p.used
+	p.used = true
+	p.mu.Unlock()
+	if used {
+		return nil, errors.New("gensupport: only one request may be sent per batched call")
+	}
+	p.reqc <- req
+	r := <-p.respc
+	return r.resp, r.err
+}
+
+// failedBatchResult returns the result passed to an operation when the
+// combined request fails. Errors from the server are turned back into
+// responses, so that the operation reports them as a *googleapi.Error
+// rather than as a transport error.
+func failedBatchResult(err error, req *http.Request) batchResult {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return batchResult{err: err}
+	}
+	return batchResult{resp: &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Code, http.StatusText(e.Code)),
+		StatusCode:    e.Code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}}
+}
+
+// BatchURL returns the URL of an API's batch endpoint. basePath is the
+// service's base path (which may have been overridden by the user),
+// servicePath is the service path from the discovery document, and batchPath
+// is the batch path relative to the API's root URL.
+func BatchURL(basePath, servicePath, batchPath string) string {
+	root := basePath
+	if servicePath != "" && strings.HasSuffix(basePath, servicePath) {
+		root = strings.TrimSuffix(basePath, servicePath)
+	} else if u, err := url.Parse(basePath); err == nil && u.Host != "" {
+		root = u.Scheme + "://" + u.Host + "/"
+	}
+	return googleapi.ResolveRelative(root, batchPath)
+}
@@ -0,0 +1,246 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// batchHandler is a batch endpoint that answers each part with a JSON body
+// describing the part's request. Requests for paths containing "missing" get
+// a 404. Response parts are written in reverse order, to check that they are
+// matched to requests by Content-ID.
+type batchHandler struct {
+	t      *testing.T
+	header http.Header // header of the last batch request
+}
+
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.header = r.Header
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		http.Error(w, "bad content type", http.StatusBadRequest)
+		return
+	}
+	type answer struct {
+		id   string
+		resp string
+	}
+	var answers []answer
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.t.Error(err)
+			return
+		}
+		if got, want := part.Header.Get("Content-Type"), "application/http"; got != want {
+			h.t.Errorf("part Content-Type: got %q, want %q", got, want)
+		}
+		req, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			h.t.Error(err)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		var resp string
+		if strings.Contains(req.URL.Path, "missing") {
+			resp = "HTTP/1.1 404 Not Found\r\nContent-Type: application/json\r\n\r\n" +
+				`{"error": {"code": 404, "message": "not found"}}`
+		} else {
+			js, _ := json.Marshal(map[string]string{
+				"method": req.Method,
+				"uri":    req.URL.RequestURI(),
+				"body":   string(body),
+				"ua":     req.Header.Get("User-Agent"),
+			})
+			resp = "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n" + string(js)
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(part.Header.Get("Content-ID"), "<"), ">")
+		answers = append(answers, answer{id, resp})
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for i := len(answers) - 1; i >= 0; i-- {
+		hdr := make(textproto.MIMEHeader)
+		hdr.Set("Content-Type", "application/http")
+		hdr.Set("Content-ID", fmt.Sprintf("<response-%s>", answers[i].id))
+		pw, _ := mw.CreatePart(hdr)
+		io.WriteString(pw, answers[i].resp)
+	}
+	mw.Close()
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.Write(buf.Bytes())
+}
+
+// batchResponse is the JSON body written by batchHandler.
+type batchResponse struct {
+	Method, URI, Body, UA string
+}
+
+// addCall queues an operation that behaves like a generated Do method: it
+// sends a request with the given client and decodes the response.
+func addCall(b *Batch, method, url, body string, got *batchResponse, gotErr *error) {
+	b.Add(func(ctx context.Context, client *http.Client) {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req, _ := http.NewRequest(method, url, r)
+		req.Header.Set("User-Agent", "test-agent")
+		res, err := SendRequest(ctx, client, req)
+		if err != nil {
+			*gotErr = err
+			return
+		}
+		defer googleapi.CloseBody(res)
+		if err := googleapi.CheckResponse(res); err != nil {
+			*gotErr = err
+			return
+		}
+		*gotErr = DecodeResponse(got, res)
+	})
+}
+
+func TestBatch(t *testing.T) {
+	h := &batchHandler{t: t}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	b := &Batch{
+		Client: srv.Client(),
+		URL:    srv.URL + "/batch/test/v1",
+		Header: http.Header{"X-Test": {"batch"}},
+	}
+	var (
+		got  [3]batchResponse
+		errs [3]error
+	)
+	addCall(b, "GET", srv.URL+"/test/v1/items/a?alt=json", "", &got[0], &errs[0])
+	addCall(b, "POST", srv.URL+"/test/v1/items?alt=json", `{"name":"b"}`, &got[1], &errs[1])
+	addCall(b, "GET", srv.URL+"/test/v1/missing/c?alt=json", "", &got[2], &errs[2])
+	if got, want := b.Len(), 3; got != want {
+		t.Errorf("Len: got %d, want %d", got, want)
+	}
+	if err := b.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.header.Get("X-Test"), "batch"; got != want {
+		t.Errorf("batch header: got %q, want %q", got, want)
+	}
+
+	want := [2]batchResponse{
+		{Method: "GET", URI: "/test/v1/items/a?alt=json", UA: "test-agent"},
+		{Method: "POST", URI: "/test/v1/items?alt=json", Body: `{"name":"b"}`, UA: "test-agent"},
+	}
+	for i := range want {
+		if errs[i] != nil {
+			t.Errorf("call %d: %v", i, errs[i])
+		}
+		if got[i] != want[i] {
+			t.Errorf("call %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if e, ok := errs[2].(*googleapi.Error); !ok || e.Code != http.StatusNotFound {
+		t.Errorf("call 2: got error %v, want *googleapi.Error with code 404", errs[2])
+	}
+
+	if err := b.Do(context.Background()); err == nil {
+		t.Error("second Do: got nil, want error")
+	}
+}
+
+func TestBatchRequestFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b := &Batch{Client: srv.Client(), URL: srv.URL + "/batch"}
+	var (
+		got  batchResponse
+		errs [2]error
+	)
+	addCall(b, "GET", srv.URL+"/items/a", "", &got, &errs[0])
+	// An operation that fails before sending its request is not part of the batch.
+	b.Add(func(ctx context.Context, client *http.Client) {
+		req, _ := http.NewRequest("GET", srv.URL+"/items/b", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		_, errs[1] = SendRequest(ctx, client, req)
+	})
+	err := b.Do(context.Background())
+	if e, ok := err.(*googleapi.Error); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got error %v, want *googleapi.Error with code 503", err)
+	}
+	if e, ok := errs[0].(*googleapi.Error); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("call 0: got error %v, want *googleapi.Error with code 503", errs[0])
+	}
+	if errs[1] == nil {
+		t.Error("call 1: got nil, want error")
+	}
+}
+
+func TestBatchNoRequests(t *testing.T) {
+	sent := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+	}))
+	defer srv.Close()
+
+	b := &Batch{Client: srv.Client(), URL: srv.URL + "/batch"}
+	var errs [2]error
+	for i := range errs {
+		i := i
+		b.Add(func(ctx context.Context, client *http.Client) {
+			req, _ := http.NewRequest("GET", srv.URL+"/items", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			_, errs[i] = SendRequest(ctx, client, req)
+		})
+	}
+	if err := b.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sent {
+		t.Error("a batch request was sent, want none")
+	}
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("call %d: got nil, want error", i)
+		}
+	}
+}
+
+func TestBatchURL(t *testing.T) {
+	for _, test := range []struct {
+		basePath, servicePath, batchPath, want string
+	}{
+		{"https://www.googleapis.com/drive/v3/", "drive/v3/", "batch/drive/v3", "https://www.googleapis.com/batch/drive/v3"},
+		{"https://sheets.googleapis.com/", "", "batch", "https://sheets.googleapis.com/batch"},
+		{"https://private.example.com/drive/v3/", "drive/v3/", "batch", "https://private.example.com/batch"},
+		{"https://private.example.com/custom/", "drive/v3/", "batch", "https://private.example.com/batch"},
+	} {
+		if got := BatchURL(test.basePath, test.servicePath, test.batchPath); got != test.want {
+			t.Errorf("BatchURL(%q, %q, %q) = %q, want %q", test.basePath, test.servicePath, test.batchPath, got, test.want)
+		}
+	}
+}
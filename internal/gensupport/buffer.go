@@ -7,6 +7,7 @@ package gensupport
 import (
 	"bytes"
 	"io"
+	"time"
 
 	"google.golang.org/api/googleapi"
 )
@@ -16,16 +17,53 @@ import (
 type MediaBuffer struct {
 	media io.Reader
 
-	chunk []byte // The current chunk which is pending upload.  The capacity is the chunk size.
+	chunk []byte // The current chunk which is pending upload.
 	err   error  // Any error generated when populating chunk by reading media.
 
 	// The absolute position of chunk in the underlying media.
 	off int64
+
+	// chunkSize is the size of the chunks read from media.
+	chunkSize int
+
+	// spare is a chunk buffer that is no longer in use.
+	spare []byte
+	// pool, if not nil, provides the chunk buffers.
+	pool googleapi.ChunkPool
+
+	// If readAhead is set, Chunk starts reading the following chunk from
+	// media in the background, and next receives it. media must not be read
+	// while next is not nil.
+	readAhead bool
+	next      chan loadedChunk
+
+	// sizer, if not nil, adapts chunkSize to the upload throughput.
+	sizer *chunkSizer
+}
+
+type loadedChunk struct {
+	buf []byte
+	err error
 }
 
 // NewMediaBuffer initializes a MediaBuffer.
 func NewMediaBuffer(media io.Reader, chunkSize int) *MediaBuffer {
-	return &MediaBuffer{media: media, chunk: make([]byte, 0, chunkSize)}
+	return &MediaBuffer{media: media, chunkSize: chunkSize, spare: make([]byte, 0, chunkSize)}
+}
+
+// newMediaBuffer returns a MediaBuffer configured by the chunking options of
+// opts.
+func newMediaBuffer(media io.Reader, opts *googleapi.MediaOptions) *MediaBuffer {
+	mb := &MediaBuffer{
+		media:     media,
+		chunkSize: opts.ChunkSize,
+		pool:      opts.ChunkPool,
+		readAhead: opts.ReadAhead,
+	}
+	if opts.ChunkUploadTime > 0 {
+		mb.sizer = &chunkSizer{target: opts.ChunkUploadTime, max: opts.MaxChunkSize}
+	}
+	return mb
 }
 
 // Chunk returns the current buffered chunk, the offset in the underlying media
@@ -34,32 +72,146 @@ func NewMediaBuffer(media io.Reader, chunkSize int) *MediaBuffer {
 func (mb *MediaBuffer) Chunk() (chunk io.Reader, off int64, size int, err error) {
 	// There may already be data in chunk if Next has not been called since the previous call to Chunk.
 	if mb.err == nil && len(mb.chunk) == 0 {
-		mb.err = mb.loadChunk()
+		if mb.next != nil {
+			c := <-mb.next
+			mb.next = nil
+			mb.chunk, mb.err = c.buf, c.err
+		} else {
+			mb.chunk, mb.err = loadChunk(mb.media, mb.buffer(mb.chunkSize), mb.chunkSize)
+		}
+		if mb.readAhead && mb.err == nil {
+			mb.startReadAhead()
+		}
 	}
 	return bytes.NewReader(mb.chunk), mb.off, len(mb.chunk), mb.err
 }
 
-// loadChunk will read from media into chunk, up to the capacity of chunk.
-func (mb *MediaBuffer) loadChunk() error {
-	bufSize := cap(mb.chunk)
-	mb.chunk = mb.chunk[:bufSize]
+// startReadAhead starts reading the chunk that follows the current one.
+func (mb *MediaBuffer) startReadAhead() {
+	next := make(chan loadedChunk, 1)
+	media, buf, size := mb.media, mb.buffer(mb.chunkSize), mb.chunkSize
+	go func() {
+		buf, err := loadChunk(media, buf, size)
+		next <- loadedChunk{buf, err}
+	}()
+	mb.next = next
+}
 
+// buffer returns an empty buffer for a chunk of size bytes, reusing the spare
+// buffer if it is large enough.
+func (mb *MediaBuffer) buffer(size int) []byte {
+	if buf := mb.spare; buf != nil && cap(buf) >= size {
+		mb.spare = nil
+		return buf[:0]
+	}
+	if mb.pool == nil {
+		mb.spare = nil
+		return make([]byte, 0, size)
+	}
+	if mb.spare != nil {
+		mb.pool.Put(mb.spare)
+		mb.spare = nil
+	}
+	return mb.pool.Get(size)
+}
+
+// loadChunk reads up to size bytes from media into buf, whose capacity must
+// be at least size.
+func loadChunk(media io.Reader, buf []byte, size int) ([]byte, error) {
+	buf = buf[:size]
 	read := 0
 	var err error
-	for err == nil && read < bufSize {
+	for err == nil && read < size {
 		var n int
-		n, err = mb.media.Read(mb.chunk[read:])
+		n, err = media.Read(buf[read:])
 		read += n
 	}
-	mb.chunk = mb.chunk[:read]
-	return err
+	return buf[:read], err
 }
 
 // Next advances to the next chunk, which will be returned by the next call to Chunk.
 // Calls to Next without a corresponding prior call to Chunk will have no effect.
 func (mb *MediaBuffer) Next() {
 	mb.off += int64(len(mb.chunk))
-	mb.chunk = mb.chunk[0:0]
+	if len(mb.chunk) > 0 {
+		mb.spare = mb.chunk[:0]
+		mb.chunk = nil
+	}
+}
+
+// stop waits for the reading ahead of the next chunk, if any, to finish, so
+// that media is no longer read once an upload returns. The chunk that was read
+// is kept for the next call to Chunk.
+func (mb *MediaBuffer) stop() {
+	if mb.next == nil {
+		return
+	}
+	c := <-mb.next
+	mb.next = make(chan loadedChunk, 1)
+	mb.next <- c
+}
+
+// adapt records that a chunk of size bytes took d to upload, and adjusts the
+// size of the chunks that are read next.
+func (mb *MediaBuffer) adapt(size int, d time.Duration) {
+	if mb.sizer == nil {
+		return
+	}
+	mb.sizer.observe(size, d)
+	mb.chunkSize = mb.sizer.size(mb.chunkSize)
+}
+
+// release returns the chunk buffers to the pool, once the media has been
+// uploaded.
+func (mb *MediaBuffer) release() {
+	if mb.pool == nil || mb.next != nil {
+		return
+	}
+	for _, buf := range [][]byte{mb.chunk, mb.spare} {
+		if cap(buf) > 0 {
+			mb.pool.Put(buf[:0])
+		}
+	}
+	mb.chunk, mb.spare = nil, nil
+}
+
+// chunkSizer picks chunk sizes that take about target to upload at the
+// measured throughput.
+type chunkSizer struct {
+	target time.Duration
+	max    int
+	rate   float64 // smoothed throughput, in bytes per second
+}
+
+// observe records that n bytes took d to upload.
+func (s *chunkSizer) observe(n int, d time.Duration) {
+	if n <= 0 || d <= 0 {
+		return
+	}
+	rate := float64(n) / d.Seconds()
+	if s.rate == 0 {
+		s.rate = rate
+	} else {
+		s.rate = (s.rate + rate) / 2
+	}
+}
+
+// size returns the size for the next chunk, a multiple of
+// MinUploadChunkSize, or cur if there is no measurement yet.
+func (s *chunkSizer) size(cur int) int {
+	if s.rate == 0 {
+		return cur
+	}
+	n := s.rate * s.target.Seconds()
+	if n > float64(s.max) {
+		n = float64(s.max)
+	}
+	size := int(n)
+	size -= size % googleapi.MinUploadChunkSize
+	if size < googleapi.MinUploadChunkSize {
+		size = googleapi.MinUploadChunkSize
+	}
+	return size
 }
 
 type readerTyper struct {
@@ -9,8 +9,11 @@ import (
 	"io"
 	"io/ioutil"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"google.golang.org/api/googleapi"
 )
@@ -37,7 +40,7 @@ func TestChunking(t *testing.T) {
 		wantChunks []string
 	}
 
-	for _, singleByteReads := range []bool{true, false} {
+	for _, mode := range []struct{ singleByteReads, readAhead bool }{{true, false}, {false, false}, {true, true}, {false, true}} {
 		for _, tc := range []testCase{
 			{
 				data:       "abcdefg",
@@ -78,11 +81,14 @@ func TestChunking(t *testing.T) {
 		} {
 			var r io.Reader = &errReader{buf: []byte(tc.data), err: tc.finalErr}
 
-			if singleByteReads {
+			if mode.singleByteReads {
 				r = iotest.OneByteReader(r)
 			}
 
 			mb := NewMediaBuffer(r, tc.chunkSize)
+			if mode.readAhead {
+				mb = newMediaBuffer(r, &googleapi.MediaOptions{ChunkSize: tc.chunkSize, ReadAhead: true})
+			}
 			var gotErr error
 			got := []string{}
 			for {
@@ -176,6 +182,126 @@ func TestPos(t *testing.T) {
 	expectChunkAtOffset(7, io.EOF)
 }
 
+// notifyReader sends the number of bytes of every read on reads.
+type notifyReader struct {
+	r     io.Reader
+	reads chan int
+}
+
+func (r *notifyReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.reads <- n
+	return n, err
+}
+
+func TestReadAhead(t *testing.T) {
+	r := &notifyReader{r: strings.NewReader("abcdefg"), reads: make(chan int, 10)}
+	mb := newMediaBuffer(r, &googleapi.MediaOptions{ChunkSize: 3, ReadAhead: true})
+	if got, err := getChunkAsString(t, mb); got != "abc" || err != nil {
+		t.Fatalf("got %q, %v; want \"abc\", nil", got, err)
+	}
+	// The second chunk is read without waiting for Next.
+	read := 0
+	for read < 6 {
+		select {
+		case n := <-r.reads:
+			read += n
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read %d bytes of the media, want 6", read)
+		}
+	}
+	mb.Next()
+	if got, err := getChunkAsString(t, mb); got != "def" || err != nil {
+		t.Errorf("got %q, %v; want \"def\", nil", got, err)
+	}
+}
+
+// countingPool is a ChunkPool that counts the buffers it hands out.
+type countingPool struct {
+	mu   sync.Mutex
+	gets int
+	puts int
+}
+
+func (p *countingPool) Get(size int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gets++
+	return make([]byte, 0, size)
+}
+
+func (p *countingPool) Put(buf []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.puts++
+}
+
+func TestChunkBufferPool(t *testing.T) {
+	for _, readAhead := range []bool{false, true} {
+		pool := &countingPool{}
+		mb := newMediaBuffer(strings.NewReader("abcdefghij"), &googleapi.MediaOptions{ChunkSize: 3, ChunkPool: pool, ReadAhead: readAhead})
+		var got []string
+		for {
+			chunk, err := getChunkAsString(t, mb)
+			got = append(got, chunk)
+			if err != nil {
+				break
+			}
+			mb.Next()
+		}
+		if want := []string{"abc", "def", "ghi", "j"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("readAhead=%t: got chunks %q, want %q", readAhead, got, want)
+		}
+		mb.release()
+		wantGets := 1
+		if readAhead {
+			wantGets = 2
+		}
+		if pool.gets != wantGets || pool.puts != wantGets {
+			t.Errorf("readAhead=%t: got %d buffers from the pool and %d returned, want %d", readAhead, pool.gets, pool.puts, wantGets)
+		}
+	}
+}
+
+func TestAdaptiveChunkSize(t *testing.T) {
+	const min = googleapi.MinUploadChunkSize
+	s := &chunkSizer{target: time.Second, max: 8 * min}
+	if got := s.size(2 * min); got != 2*min {
+		t.Errorf("without measurements: got size %d, want %d", got, 2*min)
+	}
+	for _, tc := range []struct {
+		n    int
+		d    time.Duration
+		want int
+	}{
+		// 2*min per second.
+		{2 * min, time.Second, 2 * min},
+		// 4*min per second on average, rounded down.
+		{6*min + 100, time.Second, 4 * min},
+		// Limited to max.
+		{100 * min, time.Second, 8 * min},
+	} {
+		s.observe(tc.n, tc.d)
+		if got := s.size(0); got != tc.want {
+			t.Errorf("after %d bytes in %v: got size %d, want %d", tc.n, tc.d, got, tc.want)
+		}
+	}
+	// Very slow uploads use the smallest chunks.
+	s = &chunkSizer{target: time.Second, max: 8 * min}
+	s.observe(1, time.Hour)
+	if got := s.size(2 * min); got != min {
+		t.Errorf("after a slow upload: got size %d, want %d", got, min)
+	}
+
+	mb := newMediaBuffer(strings.NewReader(strings.Repeat("x", 5*min)), &googleapi.MediaOptions{ChunkSize: min, ChunkUploadTime: time.Second, MaxChunkSize: 8 * min})
+	_, _, size, _ := mb.Chunk()
+	mb.adapt(size, time.Second/3)
+	mb.Next()
+	if _, _, size, _ := mb.Chunk(); size != 3*min {
+		t.Errorf("got second chunk of %d bytes, want %d", size, 3*min)
+	}
+}
+
 // bytes.Reader implements both Reader and ReaderAt.  The following types
 // implement various combinations of Reader, ReaderAt and ContentTyper, by
 // wrapping bytes.Reader.  All implement at least ReaderAt, so they can be
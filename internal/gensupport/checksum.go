@@ -0,0 +1,157 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// maxChecksumBody is the largest response body that is read to find the
+// checksums of uploaded media.
+const maxChecksumBody = 1 << 20
+
+// mediaHash computes checksums of media as it is written to it.
+type mediaHash struct {
+	crc hash.Hash32 // nil if CRC32C is not computed
+	md  hash.Hash   // nil if MD5 is not computed
+}
+
+func newMediaHash(c googleapi.Checksum) *mediaHash {
+	h := &mediaHash{}
+	if c&googleapi.CRC32C != 0 {
+		h.crc = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	if c&googleapi.MD5 != 0 {
+		h.md = md5.New()
+	}
+	return h
+}
+
+func (h *mediaHash) Write(p []byte) (int, error) {
+	if h.crc != nil {
+		h.crc.Write(p)
+	}
+	if h.md != nil {
+		h.md.Write(p)
+	}
+	return len(p), nil
+}
+
+// reset discards the media written so far.
+func (h *mediaHash) reset() {
+	if h.crc != nil {
+		h.crc.Reset()
+	}
+	if h.md != nil {
+		h.md.Reset()
+	}
+}
+
+// header returns the value of an X-Goog-Hash header with the checksums of the
+// media written so far.
+func (h *mediaHash) header() string {
+	var vals []string
+	if h.crc != nil {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, h.crc.Sum32())
+		vals = append(vals, "crc32c="+base64.StdEncoding.EncodeToString(b))
+	}
+	if h.md != nil {
+		vals = append(vals, "md5="+base64.StdEncoding.EncodeToString(h.md.Sum(nil)))
+	}
+	return strings.Join(vals, ",")
+}
+
+// check checks the checksums of the media against those that the server
+// reports for the uploaded media in the response to the upload, either in an
+// X-Goog-Hash header or in the crc32c and md5Hash fields of the body, as Cloud
+// Storage objects have them. If the response has neither, the checksums are
+// not checked. The body of res is left unread.
+func (h *mediaHash) check(res *http.Response) error {
+	if vals := res.Header["X-Goog-Hash"]; len(vals) > 0 {
+		return checkGoogHash(vals, h.crc, h.md)
+	}
+	if res.Body == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxChecksumBody))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+	if err != nil {
+		return err
+	}
+	var obj struct {
+		CRC32C  string `json:"crc32c"`
+		MD5Hash string `json:"md5Hash"`
+	}
+	if json.Unmarshal(body, &obj) != nil {
+		return nil
+	}
+	var vals []string
+	if obj.CRC32C != "" {
+		vals = append(vals, "crc32c="+obj.CRC32C)
+	}
+	if obj.MD5Hash != "" {
+		vals = append(vals, "md5="+obj.MD5Hash)
+	}
+	return checkGoogHash(vals, h.crc, h.md)
+}
+
+// NewVerifyingReader returns a body for res that computes the CRC32C and MD5
+// checksums of the media as it is read. If the media is read to the end, Close
+// returns an error if they do not match the checksums in the X-Goog-Hash
+// header of res. The checksums are not verified for partial or transcoded
+// media, or if the server sends none.
+func NewVerifyingReader(res *http.Response) io.ReadCloser {
+	vr := &verifyingReader{body: res.Body}
+	if vals := res.Header["X-Goog-Hash"]; len(vals) > 0 && res.StatusCode != http.StatusPartialContent &&
+		!res.Uncompressed && res.Header.Get("Content-Encoding") == "" {
+		vr.hashes = vals
+		vr.hash = newMediaHash(googleapi.CRC32C | googleapi.MD5)
+	}
+	return vr
+}
+
+type verifyingReader struct {
+	body   io.ReadCloser
+	hashes []string   // values of X-Goog-Hash
+	hash   *mediaHash // nil if the media is not verified
+	eof    bool       // whether all of the media was read
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.body.Read(p)
+	if vr.hash != nil {
+		vr.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		vr.eof = true
+	}
+	return n, err
+}
+
+func (vr *verifyingReader) Close() error {
+	err := vr.body.Close()
+	if vr.hash != nil && vr.eof {
+		if cerr := checkGoogHash(vr.hashes, vr.hash.crc, vr.hash.md); cerr != nil {
+			return cerr
+		}
+	}
+	return err
+}
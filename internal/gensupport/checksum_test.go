@@ -0,0 +1,225 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestMediaHashHeader(t *testing.T) {
+	const data = "hello, world"
+	for _, tc := range []struct {
+		c    googleapi.Checksum
+		want string
+	}{
+		{googleapi.CRC32C | googleapi.MD5, googHash([]byte(data))},
+		{googleapi.CRC32C, strings.Split(googHash([]byte(data)), ",")[0]},
+		{googleapi.MD5, strings.Split(googHash([]byte(data)), ",")[1]},
+	} {
+		h := newMediaHash(tc.c)
+		h.Write([]byte(data[:5]))
+		h.Write([]byte(data[5:]))
+		if got := h.header(); got != tc.want {
+			t.Errorf("checksums %d: got %q, want %q", tc.c, got, tc.want)
+		}
+	}
+}
+
+func TestUploadChecksums(t *testing.T) {
+	data := strings.Repeat("abcdefghij", 60000)
+	for _, tc := range []struct {
+		desc      string
+		chunkSize int
+		reply     func(w http.ResponseWriter, media string)
+		wantErr   bool
+	}{
+		{
+			desc:      "header",
+			chunkSize: googleapi.MinUploadChunkSize,
+			reply: func(w http.ResponseWriter, media string) {
+				w.Header().Set("X-Goog-Hash", googHash([]byte(media)))
+			},
+		},
+		{
+			desc:      "corrupted",
+			chunkSize: googleapi.MinUploadChunkSize,
+			reply: func(w http.ResponseWriter, media string) {
+				w.Header().Set("X-Goog-Hash", googHash([]byte(media[1:])))
+			},
+			wantErr: true,
+		},
+		{
+			desc:      "body",
+			chunkSize: googleapi.MinUploadChunkSize,
+			reply: func(w http.ResponseWriter, media string) {
+				h := strings.Split(googHash([]byte(media)), ",")
+				json.NewEncoder(w).Encode(map[string]string{
+					"crc32c":  strings.TrimPrefix(h[0], "crc32c="),
+					"md5Hash": strings.TrimPrefix(h[1], "md5="),
+				})
+			},
+		},
+		{
+			desc:      "corrupted body",
+			chunkSize: googleapi.MinUploadChunkSize,
+			reply: func(w http.ResponseWriter, media string) {
+				w.Write([]byte(`{"crc32c":"AAAAAA=="}`))
+			},
+			wantErr: true,
+		},
+		{
+			desc:      "no checksums",
+			chunkSize: googleapi.MinUploadChunkSize,
+			reply:     func(w http.ResponseWriter, media string) {},
+		},
+		{
+			desc:      "single chunk",
+			chunkSize: 2 * len(data),
+			reply: func(w http.ResponseWriter, media string) {
+				// media is the multipart body.
+				w.Header().Set("X-Goog-Hash", googHash([]byte(data)))
+			},
+		},
+	} {
+		var media []byte
+		var sent string // X-Goog-Hash of the request with the end of the media
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			media = append(media, body...)
+			if r.Header.Get("X-Goog-Hash") != "" {
+				sent = r.Header.Get("X-Goog-Hash")
+			}
+			if cr := r.Header.Get("Content-Range"); cr != "" && strings.HasSuffix(cr, "/*") {
+				w.Header().Set("X-Http-Status-Code-Override", "308")
+				return
+			}
+			tc.reply(w, string(media))
+		}))
+
+		mi := NewInfoFromMedia(strings.NewReader(data), []googleapi.MediaOption{
+			googleapi.ChunkSize(tc.chunkSize),
+			googleapi.VerifyChecksums(googleapi.CRC32C | googleapi.MD5),
+		})
+		var res *http.Response
+		var err error
+		if rx := mi.ResumableUpload(ts.URL); rx != nil {
+			rx.Client = ts.Client()
+			res, err = rx.Upload(context.Background())
+		} else {
+			hdr := make(http.Header)
+			body, _, cleanup := mi.UploadRequest(hdr, strings.NewReader("{}"))
+			req, _ := http.NewRequest("POST", ts.URL, body)
+			req.Header = hdr
+			res, err = ts.Client().Do(req)
+			cleanup()
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.desc, err)
+		}
+		if want := googHash([]byte(data)); sent != want {
+			t.Errorf("%s: sent X-Goog-Hash %q, want %q", tc.desc, sent, want)
+		}
+		err = mi.VerifyChecksums(res)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tc.desc, err, tc.wantErr)
+		}
+		// The body can still be read.
+		if _, err := ioutil.ReadAll(res.Body); err != nil {
+			t.Errorf("%s: reading body: %v", tc.desc, err)
+		}
+		res.Body.Close()
+		ts.Close()
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	const data = "hello, world"
+	for _, tc := range []struct {
+		desc    string
+		header  http.Header
+		status  int
+		readAll bool
+		wantErr bool
+	}{
+		{"match", http.Header{"X-Goog-Hash": {googHash([]byte(data))}}, http.StatusOK, true, false},
+		{"mismatch", http.Header{"X-Goog-Hash": {googHash([]byte("hello"))}}, http.StatusOK, true, true},
+		{"partial read", http.Header{"X-Goog-Hash": {googHash([]byte("hello"))}}, http.StatusOK, false, false},
+		{"partial content", http.Header{"X-Goog-Hash": {googHash([]byte("hello"))}}, http.StatusPartialContent, true, false},
+		{"transcoded", http.Header{"X-Goog-Hash": {googHash([]byte("hello"))}, "Content-Encoding": {"gzip"}}, http.StatusOK, true, false},
+		{"no checksums", http.Header{}, http.StatusOK, true, false},
+	} {
+		res := &http.Response{
+			StatusCode: tc.status,
+			Header:     tc.header,
+			Body:       ioutil.NopCloser(strings.NewReader(data)),
+		}
+		r := NewVerifyingReader(res)
+		if tc.readAll {
+			got, err := ioutil.ReadAll(r)
+			if err != nil || string(got) != data {
+				t.Errorf("%s: read %q, %v", tc.desc, got, err)
+			}
+		} else {
+			r.Read(make([]byte, 3))
+		}
+		err := r.Close()
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%s: Close returned %v, want error: %t", tc.desc, err, tc.wantErr)
+		}
+	}
+}
+
+func TestUploadChecksumsRetried(t *testing.T) {
+	oldBackoff := backoff
+	backoff = func() Backoff { return new(NoPauseBackoff) }
+	defer func() { backoff = oldBackoff }()
+
+	const data = "hello, world"
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		requests++
+		if requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Goog-Hash", googHash([]byte(data)))
+	}))
+	defer ts.Close()
+
+	mi := NewInfoFromMedia(strings.NewReader(data), []googleapi.MediaOption{
+		googleapi.ChunkSize(0),
+		googleapi.ContentType("text/plain"),
+		googleapi.VerifyChecksums(googleapi.CRC32C | googleapi.MD5),
+	})
+	hdr := make(http.Header)
+	body, getBody, cleanup := mi.UploadRequest(hdr, strings.NewReader("{}"))
+	defer cleanup()
+	if getBody == nil {
+		t.Fatal("got nil getBody, want the request to be retryable")
+	}
+	req, _ := http.NewRequest("POST", ts.URL, body)
+	req.Header = hdr
+	req.GetBody = getBody
+	res, err := SendRequestWithRetry(context.Background(), ts.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	if err := mi.VerifyChecksums(res); err != nil {
+		t.Errorf("VerifyChecksums: %v", err)
+	}
+}
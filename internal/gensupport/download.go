@@ -0,0 +1,268 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// A MediaSender sends a request for the media of a call, with rangeHeader
+// as its Range header if it is not empty. It returns an error if the response
+// does not have a 2xx status. The generated calls that support media
+// downloads have a sendMedia method of this type.
+type MediaSender func(ctx context.Context, rangeHeader string) (*http.Response, error)
+
+// DownloadRange requests length bytes of media starting at offset, or all of
+// the bytes from offset on if length is zero, and checks that the response
+// holds them. It is used by the generated DownloadRange methods.
+func DownloadRange(ctx context.Context, send MediaSender, offset, length int64) (*http.Response, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("gensupport: invalid download range: offset %d, length %d", offset, length)
+	}
+	rangeHeader := downloadRange(offset, length)
+	res, err := send(ctx, rangeHeader)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusPartialContent {
+		start, end, _, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err == nil && (start != offset || length > 0 && end >= offset+length) {
+			err = fmt.Errorf("gensupport: got Content-Range %q for Range %q", res.Header.Get("Content-Range"), rangeHeader)
+		}
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		return res, nil
+	}
+	// The server sent all of the media.
+	if offset > 0 {
+		res.Body.Close()
+		return nil, fmt.Errorf("gensupport: server ignored Range %q", rangeHeader)
+	}
+	if length > 0 {
+		res.Body = limitReadCloser{io.LimitReader(res.Body, length), res.Body}
+		if res.ContentLength > length {
+			res.ContentLength = length
+		}
+	}
+	return res, nil
+}
+
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// downloadRange returns the Range header that requests length bytes starting
+// at offset, or all of the bytes from offset on if length is zero. It returns
+// "" if the whole media is requested.
+func downloadRange(offset, length int64) string {
+	switch {
+	case length > 0:
+		return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	case offset > 0:
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return ""
+}
+
+// parseContentRange parses a Content-Range header such as
+// "bytes 0-99/1000". total is -1 if the size of the media is unknown.
+func parseContentRange(h string) (start, end, total int64, err error) {
+	bad := fmt.Errorf("gensupport: malformed Content-Range %q", h)
+	if !strings.HasPrefix(h, "bytes ") {
+		return 0, 0, 0, bad
+	}
+	h = strings.TrimPrefix(h, "bytes ")
+	i := strings.Index(h, "/")
+	j := strings.Index(h, "-")
+	if i < 0 || j < 0 || j > i {
+		return 0, 0, 0, bad
+	}
+	if start, err = strconv.ParseInt(h[:j], 10, 64); err != nil {
+		return 0, 0, 0, bad
+	}
+	if end, err = strconv.ParseInt(h[j+1:i], 10, 64); err != nil || end < start {
+		return 0, 0, 0, bad
+	}
+	total = -1
+	if h[i+1:] != "*" {
+		if total, err = strconv.ParseInt(h[i+1:], 10, 64); err != nil {
+			return 0, 0, 0, bad
+		}
+	}
+	return start, end, total, nil
+}
+
+// DownloadTo writes the media to w and returns the number of bytes written.
+// If the download fails with a transient error, it is resumed with a request
+// for the remaining bytes, unless the ETag of the media has changed. It
+// gives up if no progress is made for a while. If the server sends an
+// X-Goog-Hash header, DownloadTo verifies the CRC32C and MD5 checksums in it.
+// It is used by the generated DownloadTo methods.
+func DownloadTo(ctx context.Context, w io.WriterAt, send MediaSender) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var (
+		off     int64
+		started bool       // whether a response with the media was received
+		size    int64 = -1 // size of the media, if known
+		etag    string
+		hashes  []string // values of X-Goog-Hash
+		verify  = true
+		crc     = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+		md      = md5.New()
+	)
+	bo := backoff()
+	quitAfter := time.After(retryDeadline)
+	var (
+		pause   time.Duration
+		lastErr error
+	)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return off, ctx.Err()
+			case <-quitAfter:
+				return off, lastErr
+			case <-time.After(pause):
+			}
+		}
+		pause = bo.Pause()
+		res, err := send(ctx, downloadRange(off, 0))
+		if err != nil {
+			if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusRequestedRangeNotSatisfiable && off == size {
+				// Reading the end of the media failed, but all of it was written.
+				break
+			}
+			if !retryableDownloadError(err) {
+				return off, err
+			}
+			lastErr = err
+			continue
+		}
+		if !started {
+			// The first response with the media describes it.
+			started = true
+			etag = res.Header.Get("ETag")
+			hashes = res.Header["X-Goog-Hash"]
+			size = res.ContentLength
+			// The checksums are those of the encoded media.
+			verify = !res.Uncompressed && res.Header.Get("Content-Encoding") == ""
+		} else if e := res.Header.Get("ETag"); etag != "" && e != "" && e != etag {
+			res.Body.Close()
+			return off, errors.New("gensupport: media changed during download")
+		} else if res.StatusCode == http.StatusPartialContent {
+			if start, _, _, err := parseContentRange(res.Header.Get("Content-Range")); err != nil || start != off {
+				res.Body.Close()
+				return off, fmt.Errorf("gensupport: got Content-Range %q when resuming at byte %d", res.Header.Get("Content-Range"), off)
+			}
+		} else {
+			// The server sent all of the media again.
+			off = 0
+			crc.Reset()
+			md.Reset()
+		}
+		ow := &offsetWriter{w: w, off: off}
+		n, err := io.Copy(io.MultiWriter(ow, crc, md), res.Body)
+		res.Body.Close()
+		off += n
+		if err == nil {
+			break
+		}
+		if ow.err != nil || !shouldRetry(0, err) {
+			return off, err
+		}
+		lastErr = err
+		if n > 0 {
+			// Progress was made, so start waiting afresh.
+			bo = backoff()
+			pause = 0
+			quitAfter = time.After(retryDeadline)
+		}
+	}
+	if verify {
+		if err := checkGoogHash(hashes, crc, md); err != nil {
+			return off, err
+		}
+	}
+	return off, nil
+}
+
+// retryableDownloadError reports whether a download that failed with err
+// should be resumed.
+func retryableDownloadError(err error) bool {
+	if e, ok := err.(*googleapi.Error); ok {
+		return shouldRetry(e.Code, nil)
+	}
+	return shouldRetry(0, err)
+}
+
+// offsetWriter writes to w sequentially, starting at off.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+	err error // the error returned by w, if any
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.w.WriteAt(p, ow.off)
+	ow.off += int64(n)
+	ow.err = err
+	return n, err
+}
+
+// checkGoogHash checks the CRC32C and MD5 checksums in the values of an
+// X-Goog-Hash header, such as "crc32c=n03x6A==,md5=Ojk9c3dhfxgoKVVHYwFbHQ==",
+// against those of the downloaded media. Unknown checksum types, and those
+// whose hash is nil, are ignored.
+func checkGoogHash(values []string, crc hash.Hash32, md hash.Hash) error {
+	for _, v := range values {
+		for _, kv := range strings.Split(v, ",") {
+			i := strings.Index(kv, "=")
+			if i < 0 {
+				continue
+			}
+			name := strings.TrimSpace(kv[:i])
+			want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kv[i+1:]))
+			if err != nil {
+				return fmt.Errorf("gensupport: malformed X-Goog-Hash %q", v)
+			}
+			var got []byte
+			switch {
+			case name == "crc32c" && crc != nil:
+				got = make([]byte, 4)
+				binary.BigEndian.PutUint32(got, crc.Sum32())
+			case name == "md5" && md != nil:
+				got = md.Sum(nil)
+			default:
+				continue
+			}
+			if !bytes.Equal(got, want) {
+				return fmt.Errorf("gensupport: %s checksum mismatch: got %s, want %s",
+					name, base64.StdEncoding.EncodeToString(got), base64.StdEncoding.EncodeToString(want))
+			}
+		}
+	}
+	return nil
+}
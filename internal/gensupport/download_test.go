@@ -0,0 +1,319 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// mediaHandler serves media, honoring Range headers of the form "bytes=a-" and
+// "bytes=a-b". The first failures responses end after cut bytes, as if the
+// connection had been lost.
+type mediaHandler struct {
+	media    []byte
+	etag     string
+	hash     string // value of X-Goog-Hash
+	failures int
+	cut      int
+	ranges   []string // Range headers received
+}
+
+func (h *mediaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rng := r.Header.Get("Range")
+	h.ranges = append(h.ranges, rng)
+	start, end := 0, len(h.media)-1
+	if rng != "" {
+		var err error
+		if strings.HasSuffix(rng, "-") {
+			_, err = fmt.Sscanf(rng, "bytes=%d-", &start)
+		} else {
+			_, err = fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		}
+		if err != nil || start > end {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if start >= len(h.media) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(h.media)))
+			http.Error(w, "unsatisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if end >= len(h.media) {
+			end = len(h.media) - 1
+		}
+	}
+	if h.etag != "" {
+		w.Header().Set("ETag", h.etag)
+	}
+	if h.hash != "" {
+		w.Header().Set("X-Goog-Hash", h.hash)
+	}
+	body := h.media[start : end+1]
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	if rng != "" {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(h.media)))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	if h.failures > 0 && h.cut < len(body) {
+		h.failures--
+		// Writing less than the Content-Length makes the server close the
+		// connection, so the client sees io.ErrUnexpectedEOF.
+		w.Write(body[:h.cut])
+		return
+	}
+	w.Write(body)
+}
+
+// mediaSender returns a MediaSender that requests url with client, as the
+// generated sendMedia methods do.
+func mediaSender(client *http.Client, url string) MediaSender {
+	return func(ctx context.Context, rangeHeader string) (*http.Response, error) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		res, err := SendRequest(ctx, client, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := googleapi.CheckResponse(res); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+// googHash returns the X-Goog-Hash header value for media.
+func googHash(media []byte) string {
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.Checksum(media, crc32.MakeTable(crc32.Castagnoli)))
+	sum := md5.Sum(media)
+	return "crc32c=" + base64.StdEncoding.EncodeToString(crc) + ",md5=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// writerAt is an in-memory io.WriterAt.
+type writerAt struct {
+	buf []byte
+}
+
+func (w *writerAt) WriteAt(p []byte, off int64) (int, error) {
+	if n := int(off) + len(p); n > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, n-len(w.buf))...)
+	}
+	return copy(w.buf[off:], p), nil
+}
+
+func TestDownloadRange(t *testing.T) {
+	media := []byte("0123456789abcdefghij")
+	h := &mediaHandler{media: media}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	send := mediaSender(srv.Client(), srv.URL)
+
+	for _, test := range []struct {
+		offset, length int64
+		wantRange      string
+		want           string
+	}{
+		{0, 0, "", string(media)},
+		{5, 0, "bytes=5-", "56789abcdefghij"},
+		{5, 3, "bytes=5-7", "567"},
+		{18, 10, "bytes=18-27", "ij"},
+	} {
+		res, err := DownloadRange(context.Background(), send, test.offset, test.length)
+		if err != nil {
+			t.Errorf("DownloadRange(%d, %d): %v", test.offset, test.length, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("DownloadRange(%d, %d): got %q, want %q", test.offset, test.length, got, test.want)
+		}
+		if gotRange := h.ranges[len(h.ranges)-1]; gotRange != test.wantRange {
+			t.Errorf("DownloadRange(%d, %d): sent Range %q, want %q", test.offset, test.length, gotRange, test.wantRange)
+		}
+	}
+	if _, err := DownloadRange(context.Background(), send, -1, 0); err == nil {
+		t.Error("DownloadRange(-1, 0): got nil, want error")
+	}
+}
+
+func TestDownloadRangeIgnored(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer srv.Close()
+	send := mediaSender(srv.Client(), srv.URL)
+
+	if _, err := DownloadRange(context.Background(), send, 3, 2); err == nil {
+		t.Error("got nil, want error for a server that ignores Range")
+	}
+	// Without an offset, the body is limited to the requested length.
+	res, err := DownloadRange(context.Background(), send, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, _ := ioutil.ReadAll(res.Body)
+	if string(got) != "0123" {
+		t.Errorf("got %q, want %q", got, "0123")
+	}
+}
+
+func TestDownloadTo(t *testing.T) {
+	oldBackoff := backoff
+	backoff = func() Backoff { return new(NoPauseBackoff) }
+	defer func() { backoff = oldBackoff }()
+
+	media := bytes.Repeat([]byte("0123456789"), 100)
+	for _, test := range []struct {
+		desc       string
+		failures   int
+		hash       string
+		wantRanges []string
+		wantErr    bool
+	}{
+		{
+			desc:       "no failures",
+			hash:       googHash(media),
+			wantRanges: []string{""},
+		},
+		{
+			desc:       "resumed",
+			failures:   2,
+			hash:       googHash(media),
+			wantRanges: []string{"", "bytes=300-", "bytes=600-"},
+		},
+		{
+			desc:       "no hash",
+			failures:   1,
+			wantRanges: []string{"", "bytes=300-"},
+		},
+		{
+			desc:       "bad hash",
+			hash:       googHash(media[1:]),
+			wantRanges: []string{""},
+			wantErr:    true,
+		},
+	} {
+		h := &mediaHandler{media: media, etag: `"1"`, hash: test.hash, failures: test.failures, cut: 300}
+		srv := httptest.NewServer(h)
+		w := &writerAt{}
+		n, err := DownloadTo(context.Background(), w, mediaSender(srv.Client(), srv.URL))
+		srv.Close()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", test.desc, err, test.wantErr)
+			continue
+		}
+		if n != int64(len(media)) || !bytes.Equal(w.buf, media) {
+			t.Errorf("%s: got %d bytes %q, want %q", test.desc, n, w.buf, media)
+		}
+		if got, want := strings.Join(h.ranges, ","), strings.Join(test.wantRanges, ","); got != want {
+			t.Errorf("%s: got ranges %q, want %q", test.desc, got, want)
+		}
+	}
+}
+
+func TestDownloadToChangedMedia(t *testing.T) {
+	oldBackoff := backoff
+	backoff = func() Backoff { return new(NoPauseBackoff) }
+	defer func() { backoff = oldBackoff }()
+
+	h := &mediaHandler{media: []byte("0123456789"), etag: `"1"`, failures: 1, cut: 4}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		// The media is replaced after the first response.
+		h.etag = `"2"`
+	}))
+	defer srv.Close()
+
+	n, err := DownloadTo(context.Background(), &writerAt{}, mediaSender(srv.Client(), srv.URL))
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	if n != 4 {
+		t.Errorf("got %d bytes written, want 4", n)
+	}
+}
+
+func TestDownloadToFirstRequestFails(t *testing.T) {
+	oldBackoff := backoff
+	backoff = func() Backoff { return new(NoPauseBackoff) }
+	defer func() { backoff = oldBackoff }()
+
+	media := []byte("0123456789")
+	for _, test := range []struct {
+		desc    string
+		hash    string
+		wantErr bool
+	}{
+		{"good hash", googHash(media), false},
+		{"bad hash", googHash(media[1:]), true},
+	} {
+		h := &mediaHandler{media: media, etag: `"1"`, hash: test.hash}
+		failed := false
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !failed {
+				failed = true
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		}))
+		w := &writerAt{}
+		n, err := DownloadTo(context.Background(), w, mediaSender(srv.Client(), srv.URL))
+		srv.Close()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if n != int64(len(media)) || !bytes.Equal(w.buf, media) {
+			t.Errorf("%s: got %d bytes %q, want %q", test.desc, n, w.buf, media)
+		}
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, test := range []struct {
+		in                string
+		start, end, total int64
+		wantErr           bool
+	}{
+		{in: "bytes 0-99/1000", start: 0, end: 99, total: 1000},
+		{in: "bytes 10-19/*", start: 10, end: 19, total: -1},
+		{in: "bytes */1000", wantErr: true},
+		{in: "bytes 5-1/10", wantErr: true},
+		{in: "0-99/1000", wantErr: true},
+	} {
+		start, end, total, err := parseContentRange(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: got error %v, want error: %t", test.in, err, test.wantErr)
+			continue
+		}
+		if err == nil && (start != test.start || end != test.end || total != test.total) {
+			t.Errorf("%q: got %d, %d, %d, want %d, %d, %d", test.in, start, end, total, test.start, test.end, test.total)
+		}
+	}
+}
@@ -5,10 +5,13 @@
 package gensupport
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 )
 
 // MarshalJSON returns a JSON encoding of schema containing only selected fields.
@@ -17,8 +20,11 @@ import (
 //   * its field name is present in forceSendFields and it is not a nil pointer or nil interface
 //   * its field name is present in nullFields.
 // The JSON key for each selected field is taken from the field's json: struct tag.
+//
+// Fields of type time.Duration are encoded as "google-duration" strings, and
+// fields of type time.Time are omitted when they hold the zero time.
 func MarshalJSON(schema interface{}, forceSendFields, nullFields []string) ([]byte, error) {
-	if len(forceSendFields) == 0 && len(nullFields) == 0 {
+	if len(forceSendFields) == 0 && len(nullFields) == 0 && !hasTimeFields(reflect.TypeOf(schema)) {
 		return json.Marshal(schema)
 	}
 
@@ -48,6 +54,91 @@ func MarshalJSON(schema interface{}, forceSendFields, nullFields []string) ([]by
 	return json.Marshal(dataMap)
 }
 
+// WithoutOutputOnly returns a value whose JSON encoding is that of v, without
+// the fields that are set by the server. Such fields have a
+// `googleapi:"outputonly"` struct tag, and are kept only if they are listed in
+// the ForceSendFields of their struct. It is used by the generated doRequest
+// methods of create and update calls to encode request bodies.
+func WithoutOutputOnly(v interface{}) json.Marshaler {
+	return outputOnlyStripper{v}
+}
+
+type outputOnlyStripper struct {
+	v interface{}
+}
+
+func (s outputOnlyStripper) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(s.v)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as they are, rather than converting them to float64.
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	stripOutputOnly(reflect.ValueOf(s.v), data)
+	return json.Marshal(data)
+}
+
+// stripOutputOnly removes the output-only fields of v from data, the decoded
+// JSON encoding of v.
+func stripOutputOnly(v reflect.Value, data interface{}) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return
+		}
+		forced := fieldNames(v, "ForceSendFields")
+		st := v.Type()
+		for i := 0; i < st.NumField(); i++ {
+			f := st.Field(i)
+			jsonTag := f.Tag.Get("json")
+			if jsonTag == "" {
+				continue
+			}
+			tag, err := parseJSONTag(jsonTag)
+			if err != nil || tag.ignore {
+				continue
+			}
+			if f.Tag.Get("googleapi") == "outputonly" && !forced[f.Name] {
+				delete(m, tag.apiName)
+				continue
+			}
+			if d, ok := m[tag.apiName]; ok {
+				stripOutputOnly(v.Field(i), d)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		a, ok := data.([]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < v.Len() && i < len(a); i++ {
+			stripOutputOnly(v.Index(i), a[i])
+		}
+	case reflect.Map:
+		m, ok := data.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			if d, ok := m[k.String()]; ok {
+				stripOutputOnly(v.MapIndex(k), d)
+			}
+		}
+	}
+}
+
 func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNullMaps map[string]map[string]bool) (map[string]interface{}, error) {
 	m := make(map[string]interface{})
 	s := reflect.ValueOf(schema)
@@ -104,14 +195,16 @@ func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNu
 			continue
 		}
 
-		// nil slices are treated as empty slices.
-		if f.Type.Kind() == reflect.Slice && v.IsNil() {
+		// nil slices are treated as empty slices, unless they encode themselves.
+		if f.Type.Kind() == reflect.Slice && v.IsNil() && !f.Type.Implements(marshalerType) {
 			m[tag.apiName] = []bool{}
 			continue
 		}
 
 		if tag.stringFormat {
 			m[tag.apiName] = formatAsString(v, f.Type.Kind())
+		} else if d, ok := durationValue(v); ok {
+			m[tag.apiName] = JSONDuration(d)
 		} else {
 			m[tag.apiName] = v.Interface()
 		}
@@ -119,6 +212,54 @@ func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNu
 	return m, nil
 }
 
+var (
+	durationType  = reflect.TypeOf(time.Duration(0))
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+	timeFieldsCache sync.Map // map[reflect.Type]bool
+)
+
+// hasTimeFields reports whether t is a struct with a time.Time or
+// time.Duration field, or a pointer to one. The encoding/json package does
+// not encode such fields as the API expects.
+func hasTimeFields(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	if b, ok := timeFieldsCache.Load(t); ok {
+		return b.(bool)
+	}
+	has := false
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft == durationType || ft == timeType {
+			has = true
+			break
+		}
+	}
+	timeFieldsCache.Store(t, has)
+	return has
+}
+
+// durationValue returns the value of v if it is a time.Duration or a non-nil
+// pointer to one.
+func durationValue(v reflect.Value) (time.Duration, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+	if v.Type() != durationType {
+		return 0, false
+	}
+	return time.Duration(v.Int()), true
+}
+
 // formatAsString returns a string representation of v, dereferencing it first if possible.
 func formatAsString(v reflect.Value, kind reflect.Kind) string {
 	if kind == reflect.Ptr && !v.IsNil() {
@@ -193,6 +334,9 @@ func includeField(v reflect.Value, f reflect.StructField, mustInclude map[string
 // this function return false in situations where v should not be sent as part
 // of a PATCH operation.
 func isEmptyValue(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
 	switch v.Kind() {
 	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
 		return v.Len() == 0
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
 	"google.golang.org/api/googleapi"
 )
@@ -514,3 +515,112 @@ func TestParseMalformedJSONTag(t *testing.T) {
 		}
 	}
 }
+
+type timeSchema struct {
+	T    time.Time           `json:"t,omitempty"`
+	PT   *time.Time          `json:"pt,omitempty"`
+	D    time.Duration       `json:"d,omitempty"`
+	PD   *time.Duration      `json:"pd,omitempty"`
+	Mask googleapi.FieldMask `json:"mask,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+func TestTimeFields(t *testing.T) {
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	d := 1500 * time.Millisecond
+	for _, test := range []struct {
+		s    timeSchema
+		want string
+	}{
+		{
+			s:    timeSchema{},
+			want: `{}`,
+		},
+		{
+			s:    timeSchema{T: tm, PT: &tm, D: d, PD: &d, Mask: googleapi.FieldMask{"a", "b.c"}},
+			want: `{"t":"2021-03-04T05:06:07.000000008Z","pt":"2021-03-04T05:06:07.000000008Z","d":"1.500s","pd":"1.500s","mask":"a,b.c"}`,
+		},
+		{
+			s:    timeSchema{ForceSendFields: []string{"T", "D", "Mask"}},
+			want: `{"t":"0001-01-01T00:00:00Z","d":"0s","mask":""}`,
+		},
+		{
+			s:    timeSchema{NullFields: []string{"T", "PT", "D", "Mask"}},
+			want: `{"t":null,"pt":null,"d":null,"mask":null}`,
+		},
+	} {
+		encoded, err := MarshalJSON(test.s, test.s.ForceSendFields, test.s.NullFields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(encoded, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("MarshalJSON(%+v):\ngot : %s\nwant: %s", test.s, encoded, test.want)
+		}
+	}
+}
+
+type outputOnlySchema struct {
+	Name    string                       `json:"name,omitempty"`
+	ID      int64                        `json:"id,omitempty,string" googleapi:"outputonly"`
+	State   string                       `json:"state,omitempty" googleapi:"outputonly"`
+	Size    int64                        `json:"size,omitempty"`
+	Child   *outputOnlySchema            `json:"child,omitempty"`
+	List    []*outputOnlySchema          `json:"list,omitempty"`
+	Map     map[string]*outputOnlySchema `json:"map,omitempty"`
+	Created string                       `json:"created,omitempty" googleapi:"outputonly"`
+
+	ForceSendFields []string `json:"-"`
+}
+
+func TestWithoutOutputOnly(t *testing.T) {
+	for _, test := range []struct {
+		in   interface{}
+		want string
+	}{
+		{
+			in:   &outputOnlySchema{Name: "a", ID: 3, State: "ON", Size: 1 << 60},
+			want: `{"name":"a","size":1152921504606846976}`,
+		},
+		{
+			in: &outputOnlySchema{
+				Name:  "a",
+				Child: &outputOnlySchema{Name: "b", State: "ON"},
+				List:  []*outputOnlySchema{{Name: "c", ID: 1}, nil},
+				Map:   map[string]*outputOnlySchema{"k": {Name: "d", Created: "now"}},
+			},
+			want: `{"name":"a","child":{"name":"b"},"list":[{"name":"c"},null],"map":{"k":{"name":"d"}}}`,
+		},
+		{
+			in:   &outputOnlySchema{Name: "a", State: "ON", ForceSendFields: []string{"State"}},
+			want: `{"name":"a","state":"ON"}`,
+		},
+		{
+			in:   (*outputOnlySchema)(nil),
+			want: `null`,
+		},
+	} {
+		encoded, err := json.Marshal(WithoutOutputOnly(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(encoded, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("WithoutOutputOnly(%+v):\ngot : %s\nwant: %s", test.in, encoded, test.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JSONDuration is a time.Duration that is transmitted in JSON as a string of
+// decimal seconds with an "s" suffix, such as "3.5s". This is the encoding of
+// fields with the "google-duration" format, as described in
+// https://developers.google.com/protocol-buffers/docs/proto3#json.
+type JSONDuration time.Duration
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d JSONDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(formatDuration(time.Duration(d)))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *JSONDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("google.golang.org/api/internal: duration not a string: %v", err)
+	}
+	if !strings.HasSuffix(s, "s") {
+		return fmt.Errorf("google.golang.org/api/internal: bad duration string %q", s)
+	}
+	dd, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("google.golang.org/api/internal: bad duration string %q", s)
+	}
+	*d = JSONDuration(dd)
+	return nil
+}
+
+// formatDuration formats d as seconds with 0, 3, 6 or 9 fractional digits,
+// whichever is the fewest that represent d exactly.
+func formatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+	}
+	secs := int64(d / time.Second)
+	nanos := int64(d % time.Second)
+	if secs < 0 {
+		secs = -secs
+	}
+	if nanos < 0 {
+		nanos = -nanos
+	}
+	switch {
+	case nanos == 0:
+		return fmt.Sprintf("%s%ds", sign, secs)
+	case nanos%1e6 == 0:
+		return fmt.Sprintf("%s%d.%03ds", sign, secs, nanos/1e6)
+	case nanos%1e3 == 0:
+		return fmt.Sprintf("%s%d.%06ds", sign, secs, nanos/1e3)
+	default:
+		return fmt.Sprintf("%s%d.%09ds", sign, secs, nanos)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONDuration(t *testing.T) {
+	for _, test := range []struct {
+		d    time.Duration
+		json string
+	}{
+		{0, `"0s"`},
+		{3 * time.Second, `"3s"`},
+		{3500 * time.Millisecond, `"3.500s"`},
+		{-500 * time.Millisecond, `"-0.500s"`},
+		{time.Second + 340012*time.Nanosecond, `"1.000340012s"`},
+		{2*time.Hour + 7*time.Microsecond, `"7200.000007s"`},
+		{-90 * time.Second, `"-90s"`},
+	} {
+		got, err := json.Marshal(JSONDuration(test.d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.json {
+			t.Errorf("Marshal(%v): got %s, want %s", test.d, got, test.json)
+		}
+		var d JSONDuration
+		if err := json.Unmarshal([]byte(test.json), &d); err != nil {
+			t.Fatal(err)
+		}
+		if time.Duration(d) != test.d {
+			t.Errorf("Unmarshal(%s): got %v, want %v", test.json, time.Duration(d), test.d)
+		}
+	}
+	var d JSONDuration
+	if err := json.Unmarshal([]byte(`"3.5s"`), &d); err != nil || time.Duration(d) != 3500*time.Millisecond {
+		t.Errorf(`Unmarshal("3.5s"): got %v, %v, want 3.5s, nil`, time.Duration(d), err)
+	}
+}
+
+func TestJSONDurationErrors(t *testing.T) {
+	var d JSONDuration
+	for _, in := range []string{"", "3", `"3"`, `"3m"`, `"s"`, `"1.5.2s"`} {
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("%q: got nil, want error", in)
+		}
+	}
+}
@@ -201,10 +201,16 @@ func typeHeader(contentType string) textproto.MIMEHeader {
 // After PrepareUpload has been called, media should no longer be used: the
 // media content should be accessed via one of the return values.
 func PrepareUpload(media io.Reader, chunkSize int) (r io.Reader, mb *MediaBuffer, singleChunk bool) {
-	if chunkSize == 0 { // do not chunk
+	return prepareUpload(media, &googleapi.MediaOptions{ChunkSize: chunkSize})
+}
+
+// prepareUpload is like PrepareUpload, but the MediaBuffer also gets the
+// other chunking options of opts.
+func prepareUpload(media io.Reader, opts *googleapi.MediaOptions) (r io.Reader, mb *MediaBuffer, singleChunk bool) {
+	if opts.ChunkSize == 0 { // do not chunk
 		return media, nil, true
 	}
-	mb = NewMediaBuffer(media, chunkSize)
+	mb = newMediaBuffer(media, opts)
 	_, _, _, err := mb.Chunk()
 	// If err is io.EOF, we can upload this in a single request. Otherwise, err is
 	// either nil or a non-EOF error. If it is the latter, then the next call to
@@ -223,18 +229,41 @@ type MediaInfo struct {
 	mType           string
 	size            int64 // mediaSize, if known.  Used only for calls to progressUpdater_.
 	progressUpdater googleapi.ProgressUpdater
+	sessionUpdater  googleapi.UploadSessionUpdater
+	// session and resumeFrom are set for an upload resumed from a saved session.
+	session    *googleapi.UploadSession
+	resumeFrom io.ReaderAt
+	// hash, if not nil, computes the checksums of the media as it is read.
+	hash *mediaHash
+	// retry configures how the upload of a chunk is retried.
+	retry chunkRetry
+	// progress is reported to an UploadProgressUpdater.
+	progress *uploadProgress
 }
 
 // NewInfoFromMedia should be invoked from the Media method of a call. It returns a
 // MediaInfo populated with chunk size and content type, and a reader or MediaBuffer
 // if needed.
 func NewInfoFromMedia(r io.Reader, options []googleapi.MediaOption) *MediaInfo {
-	mi := &MediaInfo{}
+	mi := &MediaInfo{progress: newUploadProgress(-1)}
 	opts := googleapi.ProcessMediaOptions(options)
 	if !opts.ForceEmptyContentType {
 		r, mi.mType = DetermineContentType(r, opts.ContentType)
 	}
-	mi.media, mi.buffer, mi.singleChunk = PrepareUpload(r, opts.ChunkSize)
+	if opts.Checksums != 0 {
+		mi.hash = newMediaHash(opts.Checksums)
+	}
+	if opts.ChunkSize != 0 {
+		// Media sent in a single request is hashed and counted as it is sent,
+		// so that readerFunc still sees the reader and the request can be
+		// retried.
+		if mi.hash != nil {
+			r = io.TeeReader(r, mi.hash)
+		}
+		r = mi.progress.sourceReader(r)
+	}
+	mi.media, mi.buffer, mi.singleChunk = prepareUpload(r, opts)
+	mi.retry = chunkRetryFromOptions(opts)
 	return mi
 }
 
@@ -243,12 +272,31 @@ func NewInfoFromMedia(r io.Reader, options []googleapi.MediaOption) *MediaInfo {
 func NewInfoFromResumableMedia(r io.ReaderAt, size int64, mediaType string) *MediaInfo {
 	rdr := ReaderAtToReader(r, size)
 	rdr, mType := DetermineContentType(rdr, mediaType)
+	progress := newUploadProgress(size)
 	return &MediaInfo{
 		size:        size,
 		mType:       mType,
-		buffer:      NewMediaBuffer(rdr, googleapi.DefaultUploadChunkSize),
+		buffer:      NewMediaBuffer(progress.sourceReader(rdr), googleapi.DefaultUploadChunkSize),
 		media:       nil,
 		singleChunk: false,
+		progress:    progress,
+	}
+}
+
+// NewInfoFromUploadSession should be invoked from the ResumeUpload method of
+// a call. It returns a MediaInfo that resumes the upload described by s, whose
+// media of the given size is read from r.
+func NewInfoFromUploadSession(s *googleapi.UploadSession, r io.ReaderAt, size int64) *MediaInfo {
+	session := *s
+	if session.ChunkSize <= 0 {
+		session.ChunkSize = googleapi.DefaultUploadChunkSize
+	}
+	return &MediaInfo{
+		size:       size,
+		mType:      session.MediaType,
+		session:    &session,
+		resumeFrom: r,
+		progress:   newUploadProgress(size),
 	}
 }
 
@@ -259,6 +307,22 @@ func (mi *MediaInfo) SetProgressUpdater(pu googleapi.ProgressUpdater) {
 	}
 }
 
+// SetSessionUpdater sets the function that is called with the session of a
+// resumable upload.
+func (mi *MediaInfo) SetSessionUpdater(u googleapi.UploadSessionUpdater) {
+	if mi != nil {
+		mi.sessionUpdater = u
+	}
+}
+
+// SetUploadProgressUpdater sets the function that is called with the
+// progress of the upload.
+func (mi *MediaInfo) SetUploadProgressUpdater(u googleapi.UploadProgressUpdater) {
+	if mi != nil {
+		mi.progress.setUpdater(u)
+	}
+}
+
 // UploadType determines the type of upload: a single request, or a resumable
 // series of requests.
 func (mi *MediaInfo) UploadType() string {
@@ -275,6 +339,7 @@ func (mi *MediaInfo) UploadRequest(reqHeaders http.Header, body io.Reader) (newB
 	if mi == nil {
 		return body, nil, cleanup
 	}
+	mi.progress.begin()
 	var media io.Reader
 	if mi.media != nil {
 		// This only happens when the caller has turned off chunking. In that
@@ -289,14 +354,25 @@ func (mi *MediaInfo) UploadRequest(reqHeaders http.Header, body io.Reader) (newB
 	if media != nil {
 		fb := readerFunc(body)
 		fm := readerFunc(media)
+		if mi.media != nil {
+			media = mi.progress.sendSourceReader(mi.hashReader(media))
+		} else {
+			media = mi.progress.sendReader(media, 0)
+		}
 		combined, ctype := CombineBodyMedia(body, "application/json", media, mi.mType)
 		toCleanup := []io.Closer{
 			combined,
 		}
 		if fb != nil && fm != nil {
 			getBody = func() (io.ReadCloser, error) {
+				mi.progress.retry()
 				rb := ioutil.NopCloser(fb())
-				rm := ioutil.NopCloser(fm())
+				var rm io.ReadCloser
+				if mi.media != nil {
+					rm = ioutil.NopCloser(mi.progress.sendSourceReader(mi.hashReader(fm())))
+				} else {
+					rm = ioutil.NopCloser(mi.progress.sendReader(fm(), 0))
+				}
 				var mimeBoundary string
 				if _, params, err := mime.ParseMediaType(ctype); err == nil {
 					mimeBoundary = params["boundary"]
@@ -315,12 +391,27 @@ func (mi *MediaInfo) UploadRequest(reqHeaders http.Header, body io.Reader) (newB
 		reqHeaders.Set("Content-Type", ctype)
 		body = combined
 	}
+	if mi.singleChunk && mi.buffer != nil && mi.hash != nil {
+		// All of the media has been read.
+		reqHeaders.Set("X-Goog-Hash", mi.hash.header())
+	}
 	if mi.buffer != nil && mi.mType != "" && !mi.singleChunk {
 		reqHeaders.Set("X-Upload-Content-Type", mi.mType)
 	}
 	return body, getBody, cleanup
 }
 
+// hashReader returns a reader that hashes the media in r, all of the media
+// of an upload that is not chunked, as it is sent. The hash starts afresh, so
+// that a request that is sent again is not hashed twice.
+func (mi *MediaInfo) hashReader(r io.Reader) io.Reader {
+	if mi.hash == nil {
+		return r
+	}
+	mi.hash.reset()
+	return io.TeeReader(r, mi.hash)
+}
+
 // readerFunc returns a function that always returns an io.Reader that has the same
 // contents as r, provided that can be done without consuming r. Otherwise, it
 // returns nil.
@@ -356,6 +447,53 @@ func (mi *MediaInfo) ResumableUpload(locURI string) *ResumableUpload {
 				mi.progressUpdater(curr, mi.size)
 			}
 		},
+		SessionUpdater: mi.sessionUpdater,
+		hash:           mi.hash,
+		retry:          mi.retry,
+		tracker:        mi.progress,
+	}
+}
+
+// UploadComplete records that the server has accepted the media. It is
+// called by Do once the upload is complete.
+func (mi *MediaInfo) UploadComplete() {
+	if mi != nil {
+		mi.progress.finish()
+	}
+}
+
+// VerifyChecksums checks the checksums of the uploaded media, if they were
+// requested with googleapi.VerifyChecksums, against those that the server
+// reports in res, the response to the upload.
+func (mi *MediaInfo) VerifyChecksums(res *http.Response) error {
+	if mi == nil || mi.hash == nil || res == nil {
+		return nil
+	}
+	return mi.hash.check(res)
+}
+
+// ResumedUpload returns a ResumableUpload that continues the upload of the
+// saved session of mi, or nil if mi does not resume an upload. The request
+// that starts an upload is then not sent.
+func (mi *MediaInfo) ResumedUpload() *ResumableUpload {
+	if mi == nil || mi.session == nil {
+		return nil
+	}
+	return &ResumableUpload{
+		URI:       mi.session.URI,
+		MediaType: mi.mType,
+		Callback: func(curr int64) {
+			if mi.progressUpdater != nil {
+				mi.progressUpdater(curr, mi.size)
+			}
+		},
+		SessionUpdater: mi.sessionUpdater,
+		tracker:        mi.progress,
+		resume: &resumeSource{
+			r:         mi.resumeFrom,
+			size:      mi.size,
+			chunkSize: mi.session.ChunkSize,
+		},
 	}
 }
 
@@ -280,6 +280,8 @@ func TestUploadRequestGetBody(t *testing.T) {
 		desc        string
 		r           io.Reader
 		chunkSize   int
+		contentType string
+		progress    bool // whether an UploadProgressUpdater is set
 		wantGetBody bool
 	}{
 		{
@@ -288,6 +290,21 @@ func TestUploadRequestGetBody(t *testing.T) {
 			chunkSize:   0,
 			wantGetBody: false,
 		},
+		{
+			desc:        "chunk size of zero, strings.Reader: getBody",
+			r:           strings.NewReader("media"),
+			chunkSize:   0,
+			contentType: "text/plain",
+			wantGetBody: true,
+		},
+		{
+			desc:        "chunk size of zero, strings.Reader, progress reported: getBody",
+			r:           strings.NewReader("media"),
+			chunkSize:   0,
+			contentType: "text/plain",
+			progress:    true,
+			wantGetBody: true,
+		},
 		{
 			desc:        "chunk size == data size: 1 chunk, getBody",
 			r:           &nullReader{googleapi.MinUploadChunkSize},
@@ -305,7 +322,14 @@ func TestUploadRequestGetBody(t *testing.T) {
 	} {
 		cryptorand.Reader = mathrand.New(mathrand.NewSource(int64(i)))
 
-		mi := NewInfoFromMedia(test.r, []googleapi.MediaOption{googleapi.ChunkSize(test.chunkSize)})
+		opts := []googleapi.MediaOption{googleapi.ChunkSize(test.chunkSize)}
+		if test.contentType != "" {
+			opts = append(opts, googleapi.ContentType(test.contentType))
+		}
+		mi := NewInfoFromMedia(test.r, opts)
+		if test.progress {
+			mi.SetUploadProgressUpdater(func(*googleapi.UploadProgress) {})
+		}
 		r, getBody, _ := mi.UploadRequest(http.Header{}, bytes.NewBuffer([]byte("body")))
 		if got, want := (getBody != nil), test.wantGetBody; got != want {
 			t.Errorf("%s: getBody: got %t, want %t", test.desc, got, want)
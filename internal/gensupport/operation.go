@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// operationBackoff returns the Backoff used between polls of a long-running
+// operation. It is a variable so that tests can replace it.
+var operationBackoff = func(opts *googleapi.WaitOptions) Backoff {
+	bo := &gax.Backoff{
+		Initial:    time.Second,
+		Max:        time.Minute,
+		Multiplier: 1.5,
+	}
+	if opts != nil {
+		if opts.InitialDelay > 0 {
+			bo.Initial = opts.InitialDelay
+		}
+		if opts.MaxDelay > 0 {
+			bo.Max = opts.MaxDelay
+		}
+		if opts.Multiplier >= 1 {
+			bo.Multiplier = opts.Multiplier
+		}
+	}
+	return bo
+}
+
+// WaitOperation calls poll, pausing before each call as configured by opts,
+// until done reports that the operation has completed. It returns the first
+// error from poll, or the context's error if ctx is done first. It is used by
+// the generated Wait methods of long-running operations.
+func WaitOperation(ctx context.Context, opts *googleapi.WaitOptions, done func() bool, poll func() error) error {
+	bo := operationBackoff(opts)
+	for !done() {
+		t := time.NewTimer(bo.Pause())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if err := poll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusHTTPCodes maps the canonical codes of google.rpc.Status, which are
+// gRPC status codes, to HTTP status codes.
+// See https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto.
+var statusHTTPCodes = map[int64]int{
+	0:  http.StatusOK,
+	1:  499, // CANCELLED: Client Closed Request
+	2:  http.StatusInternalServerError,
+	3:  http.StatusBadRequest,
+	4:  http.StatusGatewayTimeout,
+	5:  http.StatusNotFound,
+	6:  http.StatusConflict,
+	7:  http.StatusForbidden,
+	8:  http.StatusTooManyRequests,
+	9:  http.StatusBadRequest,
+	10: http.StatusConflict,
+	11: http.StatusBadRequest,
+	12: http.StatusNotImplemented,
+	13: http.StatusInternalServerError,
+	14: http.StatusServiceUnavailable,
+	15: http.StatusInternalServerError,
+	16: http.StatusUnauthorized,
+}
+
+// StatusError returns the error described by a google.rpc.Status, such as the
+// error of a failed long-running operation, as a *googleapi.Error. The code of
+// the status is converted to the corresponding HTTP status code.
+func StatusError(code int64, message string, details []googleapi.RawMessage) *googleapi.Error {
+	httpCode, ok := statusHTTPCodes[code]
+	if !ok {
+		httpCode = http.StatusInternalServerError
+	}
+	e := &googleapi.Error{Code: httpCode, Message: message}
+	for _, d := range details {
+		var v interface{}
+		if err := json.Unmarshal(d, &v); err == nil {
+			e.Details = append(e.Details, v)
+		}
+	}
+	return e
+}
+
+// SelfLinkURL returns the URL to use to fetch a resource with the given self
+// link, such as a Compute Engine operation. The part of selfLink that follows
+// the path of defaultBasePath, the API's default base path, is resolved
+// against basePath, so that requests go to the endpoint the service was
+// configured with. If selfLink is not under defaultBasePath it is returned
+// unchanged.
+func SelfLinkURL(basePath, defaultBasePath, selfLink string) string {
+	u, err := url.Parse(selfLink)
+	if err != nil {
+		return selfLink
+	}
+	d, err := url.Parse(defaultBasePath)
+	if err != nil || !strings.HasPrefix(u.Path, d.Path) {
+		return selfLink
+	}
+	rel := &url.URL{Path: strings.TrimPrefix(u.Path, d.Path), RawQuery: u.RawQuery}
+	return googleapi.ResolveRelative(basePath, rel.String())
+}
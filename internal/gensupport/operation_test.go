@@ -0,0 +1,91 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestWaitOperation(t *testing.T) {
+	oldBackoff := operationBackoff
+	defer func() { operationBackoff = oldBackoff }()
+	operationBackoff = func(*googleapi.WaitOptions) Backoff { return new(NoPauseBackoff) }
+
+	ctx := context.Background()
+	polls := 0
+	done := func() bool { return polls == 3 }
+	poll := func() error { polls++; return nil }
+	if err := WaitOperation(ctx, nil, done, poll); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 {
+		t.Errorf("got %d polls, want 3", polls)
+	}
+
+	// An operation that is already done is not polled.
+	if err := WaitOperation(ctx, nil, done, poll); err != nil || polls != 3 {
+		t.Errorf("got %d polls, %v; want 3 polls, nil", polls, err)
+	}
+
+	wantErr := errors.New("poll failed")
+	err := WaitOperation(ctx, nil, func() bool { return false }, func() error { return wantErr })
+	if err != wantErr {
+		t.Errorf("got %v, want %v", err, wantErr)
+	}
+}
+
+func TestWaitOperationCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := &googleapi.WaitOptions{InitialDelay: time.Hour}
+	err := WaitOperation(ctx, opts, func() bool { return false }, func() error {
+		t.Error("unexpected poll")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	details := []googleapi.RawMessage{googleapi.RawMessage(`{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"R"}`)}
+	got := StatusError(5, "not found", details)
+	want := &googleapi.Error{
+		Code:    http.StatusNotFound,
+		Message: "not found",
+		Details: []interface{}{map[string]interface{}{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "R"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := StatusError(99, "", nil).Code; got != http.StatusInternalServerError {
+		t.Errorf("unknown code: got HTTP status %d, want %d", got, http.StatusInternalServerError)
+	}
+}
+
+func TestSelfLinkURL(t *testing.T) {
+	const (
+		defaultBase = "https://compute.googleapis.com/compute/v1/"
+		link        = "https://www.googleapis.com/compute/v1/projects/p/zones/z/operations/op-1"
+	)
+	for _, test := range []struct {
+		basePath, selfLink, want string
+	}{
+		{defaultBase, link, "https://compute.googleapis.com/compute/v1/projects/p/zones/z/operations/op-1"},
+		{"https://private.example.com/compute/v1/", link, "https://private.example.com/compute/v1/projects/p/zones/z/operations/op-1"},
+		{defaultBase, "https://example.com/other/op-1", "https://example.com/other/op-1"},
+	} {
+		if got := SelfLinkURL(test.basePath, defaultBase, test.selfLink); got != test.want {
+			t.Errorf("SelfLinkURL(%q, %q, %q) = %q, want %q", test.basePath, defaultBase, test.selfLink, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"reflect"
+	"strings"
+)
+
+// DiffForPatch compares two versions of a schema struct, old and new, which
+// must be pointers to the same type. It returns the update mask that lists
+// the paths of the fields of new that differ from old, and a copy of new that
+// holds only those fields. Fields listed in the ForceSendFields or NullFields
+// of new are always included. Nested structs set in both versions are
+// compared field by field; other fields are compared as a whole. A nil old
+// is treated as a struct with no fields set.
+//
+// If no field differs, DiffForPatch returns an empty mask and new itself.
+// It is used by the generated methods that set the update mask of Patch
+// calls.
+func DiffForPatch(old, new interface{}) (mask string, body interface{}) {
+	nv := reflect.ValueOf(new)
+	if nv.Kind() != reflect.Ptr || nv.IsNil() || nv.Elem().Kind() != reflect.Struct {
+		return "", new
+	}
+	var ov reflect.Value
+	if o := reflect.ValueOf(old); o.IsValid() && o.Type() == nv.Type() && !o.IsNil() {
+		ov = o.Elem()
+	}
+	paths, partial := diffStruct(ov, nv.Elem(), "")
+	if len(paths) == 0 {
+		return "", new
+	}
+	p := reflect.New(partial.Type())
+	p.Elem().Set(partial)
+	return strings.Join(paths, ","), p.Interface()
+}
+
+// diffStruct returns the paths, each starting with prefix, of the fields of
+// nv that differ from ov, and a copy of nv that holds only those fields. ov
+// is the zero Value if there is no old version.
+func diffStruct(ov, nv reflect.Value, prefix string) ([]string, reflect.Value) {
+	st := nv.Type()
+	out := reflect.New(st).Elem()
+	forced := fieldNames(nv, "ForceSendFields")
+	nulls := fieldNames(nv, "NullFields")
+	var paths []string
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		if f.Name == "ForceSendFields" || f.Name == "NullFields" {
+			// Keep the lists, so that the fields in them are encoded.
+			out.Field(i).Set(nv.Field(i))
+			continue
+		}
+		jsonTag := f.Tag.Get("json")
+		if jsonTag == "" {
+			continue
+		}
+		tag, err := parseJSONTag(jsonTag)
+		if err != nil || tag.ignore {
+			continue
+		}
+		path := prefix + tag.apiName
+		nf := nv.Field(i)
+		var of reflect.Value
+		if ov.IsValid() {
+			of = ov.Field(i)
+		}
+		switch {
+		case forced[f.Name] || nulls[f.Name]:
+		case !of.IsValid():
+			if isEmptyValue(nf) {
+				continue
+			}
+		case reflect.DeepEqual(of.Interface(), nf.Interface()):
+			continue
+		case nf.Kind() == reflect.Ptr && nf.Type().Elem().Kind() == reflect.Struct && !nf.IsNil() && !of.IsNil():
+			sub, partial := diffStruct(of.Elem(), nf.Elem(), path+".")
+			paths = append(paths, sub...)
+			p := reflect.New(partial.Type())
+			p.Elem().Set(partial)
+			out.Field(i).Set(p)
+			continue
+		}
+		paths = append(paths, path)
+		out.Field(i).Set(nf)
+	}
+	return paths, out
+}
+
+// fieldNames returns the names in the []string field called name of the
+// struct v, if it has one.
+func fieldNames(v reflect.Value, name string) map[string]bool {
+	names := make(map[string]bool)
+	if f := v.FieldByName(name); f.IsValid() {
+		l, _ := f.Interface().([]string)
+		for _, n := range l {
+			names[n] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type patchSchema struct {
+	Name   string            `json:"name,omitempty"`
+	Size   int64             `json:"size,omitempty,string"`
+	Done   bool              `json:"done,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Child  *patchSchema      `json:"child,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+func (s *patchSchema) MarshalJSON() ([]byte, error) {
+	type NoMethod patchSchema
+	raw := NoMethod(*s)
+	return MarshalJSON(raw, s.ForceSendFields, s.NullFields)
+}
+
+func TestDiffForPatch(t *testing.T) {
+	old := &patchSchema{
+		Name:   "a",
+		Size:   1,
+		Done:   true,
+		Labels: map[string]string{"k": "v"},
+		Child:  &patchSchema{Name: "b", Size: 2},
+	}
+	for _, test := range []struct {
+		desc     string
+		old, new *patchSchema
+		wantMask string
+		wantBody string
+		wantSame bool
+	}{
+		{
+			desc:     "unchanged",
+			old:      old,
+			new:      &patchSchema{Name: "a", Size: 1, Done: true, Labels: map[string]string{"k": "v"}, Child: &patchSchema{Name: "b", Size: 2}},
+			wantSame: true,
+		},
+		{
+			desc:     "changed and cleared",
+			old:      old,
+			new:      &patchSchema{Name: "c", Size: 1, Labels: map[string]string{"k": "w"}, Child: &patchSchema{Name: "b", Size: 3}},
+			wantMask: "name,done,labels,child.size",
+			wantBody: `{"name":"c","labels":{"k":"w"},"child":{"size":"3"}}`,
+		},
+		{
+			desc:     "nested removed",
+			old:      old,
+			new:      &patchSchema{Name: "a", Size: 1, Done: true, Labels: map[string]string{"k": "v"}},
+			wantMask: "child",
+			wantBody: `{}`,
+		},
+		{
+			desc:     "forced and null",
+			old:      old,
+			new:      &patchSchema{Size: 1, Labels: map[string]string{"k": "v"}, Child: &patchSchema{Name: "b", Size: 2}, ForceSendFields: []string{"Done"}, NullFields: []string{"Name"}},
+			wantMask: "name,done",
+			wantBody: `{"done":false,"name":null}`,
+		},
+		{
+			desc:     "no old version",
+			old:      nil,
+			new:      &patchSchema{Name: "a", Child: &patchSchema{Done: true}},
+			wantMask: "name,child",
+			wantBody: `{"name":"a","child":{"done":true}}`,
+		},
+	} {
+		mask, body := DiffForPatch(test.old, test.new)
+		if test.wantSame {
+			if mask != "" || body != test.new {
+				t.Errorf("%s: got (%q, %+v), want the unchanged body", test.desc, mask, body)
+			}
+			continue
+		}
+		if mask != test.wantMask {
+			t.Errorf("%s: got mask %q, want %q", test.desc, mask, test.wantMask)
+		}
+		got, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.wantBody {
+			t.Errorf("%s: got body %s, want %s", test.desc, got, test.wantBody)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// uploadProgress tracks the progress of an upload for an
+// UploadProgressUpdater. Its methods do nothing on a nil *uploadProgress.
+type uploadProgress struct {
+	now func() time.Time // for testing
+
+	mu    sync.Mutex
+	f     googleapi.UploadProgressUpdater
+	p     googleapi.UploadProgress
+	sent  int64     // bytes of the media sent, including those of the current request
+	start time.Time // zero until the upload starts
+}
+
+// newUploadProgress returns an uploadProgress for media of the given size, or
+// of unknown size if total is negative.
+func newUploadProgress(total int64) *uploadProgress {
+	if total < 0 {
+		total = -1
+	}
+	return &uploadProgress{now: time.Now, p: googleapi.UploadProgress{Total: total}}
+}
+
+// update applies change to the progress, and reports the result if the
+// upload has started.
+func (up *uploadProgress) update(change func()) {
+	if up == nil {
+		return
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	change()
+	up.report()
+}
+
+// report calls the UploadProgressUpdater with the progress, if the upload has
+// started. up.mu must be held.
+func (up *uploadProgress) report() {
+	if up.f == nil || up.start.IsZero() {
+		return
+	}
+	p := up.p
+	if d := up.now().Sub(up.start); d > 0 && up.sent > 0 {
+		p.Rate = float64(up.sent) / d.Seconds()
+		if p.Total > up.sent && !p.Done {
+			p.ETA = time.Duration(float64(p.Total-up.sent) / p.Rate * float64(time.Second))
+		}
+	}
+	up.f(&p)
+}
+
+func (up *uploadProgress) setUpdater(f googleapi.UploadProgressUpdater) {
+	if up == nil {
+		return
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.f = f
+}
+
+// active reports whether the progress is reported to anyone.
+func (up *uploadProgress) active() bool {
+	if up == nil {
+		return false
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.f != nil
+}
+
+// begin records that the upload has started. Only the first call has an
+// effect.
+func (up *uploadProgress) begin() {
+	up.update(func() {
+		if up.start.IsZero() {
+			up.start = up.now()
+		}
+	})
+}
+
+// sourceReader returns a reader that records the bytes read from r, the
+// source of the media.
+func (up *uploadProgress) sourceReader(r io.Reader) io.Reader {
+	if up == nil {
+		return r
+	}
+	return &progressReader{r, func(n int, err error) {
+		if n == 0 && err != io.EOF {
+			return
+		}
+		up.update(func() {
+			up.p.BytesRead += int64(n)
+			if err == io.EOF && up.p.Total < 0 {
+				up.p.Total = up.p.BytesRead
+			}
+		})
+	}}
+}
+
+// sendReader returns a reader that records the bytes read from r, which
+// holds the media from offset off on, as they are sent.
+func (up *uploadProgress) sendReader(r io.Reader, off int64) io.Reader {
+	if !up.active() {
+		return r
+	}
+	up.update(func() { up.sent = off })
+	return &progressReader{r, func(n int, err error) {
+		if n > 0 {
+			up.update(func() { up.sent += int64(n) })
+		}
+	}}
+}
+
+// sendSourceReader is like sendReader for r holding all of the media, but the
+// bytes sent are also counted as read, since r is the source of the media
+// too, as it is for uploads in a single request that are not chunked.
+func (up *uploadProgress) sendSourceReader(r io.Reader) io.Reader {
+	if !up.active() {
+		return r
+	}
+	up.update(func() { up.sent = 0 })
+	return &progressReader{r, func(n int, err error) {
+		if n == 0 && err != io.EOF {
+			return
+		}
+		up.update(func() {
+			up.sent += int64(n)
+			if up.sent > up.p.BytesRead {
+				up.p.BytesRead = up.sent
+			}
+			if err == io.EOF && up.p.Total < 0 {
+				up.p.Total = up.p.BytesRead
+			}
+		})
+	}}
+}
+
+// committed records that the server has the first n bytes of the media.
+func (up *uploadProgress) committed(n int64) {
+	up.update(func() {
+		up.p.BytesCommitted = n
+		up.sent = n
+	})
+}
+
+// nextChunk records that the upload of the next chunk starts.
+func (up *uploadProgress) nextChunk() {
+	up.update(func() {
+		up.p.Chunk++
+		up.p.Retries = 0
+	})
+}
+
+// retry records that the current chunk is being sent again.
+func (up *uploadProgress) retry() {
+	up.update(func() {
+		up.p.Retries++
+		up.sent = up.p.BytesCommitted
+	})
+}
+
+// resumed records that an upload resumed from a saved session continues
+// after the first off bytes of the media.
+func (up *uploadProgress) resumed(off int64) {
+	up.update(func() {
+		up.p.BytesRead = off
+		up.p.BytesCommitted = off
+		up.sent = off
+	})
+}
+
+// finish records that the upload is complete. Only the first call has an
+// effect.
+func (up *uploadProgress) finish() {
+	if up == nil {
+		return
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.p.Done {
+		return
+	}
+	up.p.Done = true
+	up.p.BytesCommitted = up.p.BytesRead
+	up.sent = up.p.BytesRead
+	if up.p.Total < 0 {
+		up.p.Total = up.p.BytesRead
+	}
+	up.report()
+}
+
+// progressReader calls count with the results of the reads from r.
+type progressReader struct {
+	r     io.Reader
+	count func(n int, err error)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.count(n, err)
+	return n, err
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestUploadProgress(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	var got []googleapi.UploadProgress
+	up := newUploadProgress(-1)
+	up.now = func() time.Time { return now }
+	up.setUpdater(func(p *googleapi.UploadProgress) { got = append(got, *p) })
+	last := func() googleapi.UploadProgress {
+		t.Helper()
+		if len(got) == 0 {
+			t.Fatal("no progress reported")
+		}
+		return got[len(got)-1]
+	}
+
+	// Reads before the upload starts are counted, but not reported.
+	src := up.sourceReader(strings.NewReader(strings.Repeat("a", 100)))
+	buf := make([]byte, 60)
+	io.ReadFull(src, buf)
+	if len(got) != 0 {
+		t.Fatalf("got %d reports before the upload started, want 0", len(got))
+	}
+	up.begin()
+	if p := last(); p.BytesRead != 60 || p.Total != -1 || p.Rate != 0 || p.ETA != 0 {
+		t.Errorf("after begin: got %+v", p)
+	}
+
+	// Send 50 bytes in 1s, and the rest of the first chunk after a retry.
+	now = now.Add(time.Second)
+	ioutil.ReadAll(up.sendReader(strings.NewReader(strings.Repeat("a", 50)), 0))
+	if p := last(); p.Rate != 50 {
+		t.Errorf("after sending 50 bytes in 1s: got rate %v, want 50", p.Rate)
+	}
+	up.retry()
+	if p := last(); p.Retries != 1 || p.Rate != 0 {
+		t.Errorf("after a retry: got %+v", p)
+	}
+	ioutil.ReadAll(up.sendReader(strings.NewReader(strings.Repeat("a", 60)), 0))
+	up.committed(60)
+	up.nextChunk()
+	if p := last(); p.BytesCommitted != 60 || p.Chunk != 1 || p.Retries != 0 || p.Rate != 60 {
+		t.Errorf("after the first chunk: got %+v", p)
+	}
+
+	// Reading the end of the media gives its size, and the ETA.
+	ioutil.ReadAll(src)
+	if p := last(); p.BytesRead != 100 || p.Total != 100 || p.ETA != time.Second*40/60 {
+		t.Errorf("after reading all of the media: got %+v", p)
+	}
+
+	now = now.Add(time.Second)
+	up.finish()
+	up.finish()
+	p := last()
+	want := googleapi.UploadProgress{BytesRead: 100, BytesCommitted: 100, Total: 100, Chunk: 1, Rate: 50, Done: true}
+	if p != want {
+		t.Errorf("after finish: got %+v, want %+v", p, want)
+	}
+	if n := len(got); got[n-2].Done {
+		t.Error("finish reported twice")
+	}
+}
+
+func TestUploadProgressSingleRequest(t *testing.T) {
+	const data = "hello, world"
+	for _, chunkSize := range []int{0, googleapi.MinUploadChunkSize} {
+		mi := NewInfoFromMedia(strings.NewReader(data), []googleapi.MediaOption{googleapi.ChunkSize(chunkSize)})
+		var got []googleapi.UploadProgress
+		mi.SetUploadProgressUpdater(func(p *googleapi.UploadProgress) { got = append(got, *p) })
+		body, _, cleanup := mi.UploadRequest(make(http.Header), strings.NewReader("{}"))
+		ioutil.ReadAll(body)
+		cleanup()
+		mi.UploadComplete()
+
+		if len(got) < 2 {
+			t.Fatalf("chunk size %d: got %d reports, want at least 2", chunkSize, len(got))
+		}
+		if p := got[0]; p.BytesCommitted != 0 || p.Done {
+			t.Errorf("chunk size %d: got first report %+v", chunkSize, p)
+		}
+		p := got[len(got)-1]
+		if p.BytesRead != int64(len(data)) || p.BytesCommitted != int64(len(data)) || p.Total != int64(len(data)) || !p.Done {
+			t.Errorf("chunk size %d: got last report %+v", chunkSize, p)
+		}
+	}
+}
+
+func TestUploadProgressChunks(t *testing.T) {
+	const min = googleapi.MinUploadChunkSize
+	data := strings.Repeat("a", 2*min+10)
+	srv := &uploadServer{t: t}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	mi := NewInfoFromMedia(strings.NewReader(data), []googleapi.MediaOption{googleapi.ChunkSize(min)})
+	var got []googleapi.UploadProgress
+	mi.SetUploadProgressUpdater(func(p *googleapi.UploadProgress) { got = append(got, *p) })
+	mi.UploadRequest(make(http.Header), strings.NewReader("{}"))
+	rx := mi.ResumableUpload(ts.URL)
+	rx.Client = ts.Client()
+	res, err := rx.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	var committed []int64
+	for _, p := range got {
+		if n := len(committed); n == 0 || committed[n-1] != p.BytesCommitted {
+			committed = append(committed, p.BytesCommitted)
+		}
+	}
+	if want := []int64{0, min, 2 * min, 2*min + 10}; !reflect.DeepEqual(committed, want) {
+		t.Errorf("got committed bytes %v, want %v", committed, want)
+	}
+	p := got[len(got)-1]
+	if p.Chunk != 2 || p.Total != int64(len(data)) || !p.Done {
+		t.Errorf("got last report %+v", p)
+	}
+}
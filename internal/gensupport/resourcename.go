@@ -0,0 +1,71 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatResourceName returns the resource name described by template, such as
+// "projects/{project}/instances/{instance}", with its variables replaced by
+// values, in order. It returns an error if the number of values does not match
+// the template, or if any of them is empty or contains "/". It is used by the
+// generated Format functions.
+func FormatResourceName(template string, values ...string) (string, error) {
+	segs := strings.Split(template, "/")
+	i := 0
+	for j, seg := range segs {
+		if !isTemplateVar(seg) {
+			continue
+		}
+		if i == len(values) {
+			return "", fmt.Errorf("gensupport: too few values for resource name %q", template)
+		}
+		if v := values[i]; v == "" || strings.Contains(v, "/") {
+			return "", fmt.Errorf("gensupport: invalid value %q for %s in resource name %q", v, seg, template)
+		}
+		segs[j] = values[i]
+		i++
+	}
+	if i != len(values) {
+		return "", fmt.Errorf("gensupport: too many values for resource name %q", template)
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// ParseResourceName returns the values of the variables of template, such as
+// "projects/{project}/instances/{instance}", in name. It returns an error if
+// name does not have the form of template, or if any of the values is empty.
+// It is used by the generated Parse functions.
+func ParseResourceName(template, name string) ([]string, error) {
+	tsegs := strings.Split(template, "/")
+	segs := strings.Split(name, "/")
+	if len(segs) != len(tsegs) {
+		return nil, resourceNameError(template, name)
+	}
+	var values []string
+	for i, tseg := range tsegs {
+		switch {
+		case !isTemplateVar(tseg):
+			if segs[i] != tseg {
+				return nil, resourceNameError(template, name)
+			}
+		case segs[i] == "":
+			return nil, resourceNameError(template, name)
+		default:
+			values = append(values, segs[i])
+		}
+	}
+	return values, nil
+}
+
+func isTemplateVar(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
+
+func resourceNameError(template, name string) error {
+	return fmt.Errorf("gensupport: resource name %q does not have the form %q", name, template)
+}
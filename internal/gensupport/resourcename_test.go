@@ -0,0 +1,61 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testNameTemplate = "projects/{project}/locations/{location}/instances/{instance}"
+
+func TestFormatResourceName(t *testing.T) {
+	got, err := FormatResourceName(testNameTemplate, "p", "us-central1", "i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "projects/p/locations/us-central1/instances/i"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, values := range [][]string{
+		{"p", "", "i"},
+		{"p", "us-central1", "i/j"},
+		{"p", "us-central1"},
+		{"p", "us-central1", "i", "j"},
+	} {
+		if got, err := FormatResourceName(testNameTemplate, values...); err == nil {
+			t.Errorf("%q: got %q, want error", values, got)
+		} else if !strings.HasPrefix(err.Error(), "gensupport: ") {
+			t.Errorf("%q: got error %q, want one starting with \"gensupport: \"", values, err)
+		}
+	}
+}
+
+func TestParseResourceName(t *testing.T) {
+	got, err := ParseResourceName(testNameTemplate, "projects/p/locations/us-central1/instances/i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"p", "us-central1", "i"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, name := range []string{
+		"",
+		"projects/p/locations/us-central1",
+		"projects/p/locations/us-central1/instances/i/extra",
+		"projects/p/location/us-central1/instances/i",
+		"projects//locations/us-central1/instances/i",
+		"projects/p/locations/us-central1/instances/",
+	} {
+		if _, err := ParseResourceName(testNameTemplate, name); err == nil {
+			t.Errorf("%q: got nil, want error", name)
+		} else if !strings.HasPrefix(err.Error(), "gensupport: ") {
+			t.Errorf("%q: got error %q, want one starting with \"gensupport: \"", name, err)
+		}
+	}
+}
@@ -9,11 +9,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
 )
 
 // Backoff is an interface around gax.Backoff's Pause method, allowing tests to provide their
@@ -57,6 +61,79 @@ type ResumableUpload struct {
 
 	// Callback is an optional function that will be periodically called with the cumulative number of bytes uploaded.
 	Callback func(int64)
+
+	// SessionUpdater is an optional function that will be called with the
+	// session of the upload when it starts and after each chunk is uploaded.
+	SessionUpdater googleapi.UploadSessionUpdater
+
+	// resume is set for an upload resumed from a saved session. Media is
+	// nil until the server has been asked how much of the media it has.
+	resume *resumeSource
+
+	// hash, if not nil, holds the checksums of the media, which are sent
+	// with the final chunk.
+	hash *mediaHash
+
+	// retry configures how the upload of a chunk is retried.
+	retry chunkRetry
+
+	// tracker, if not nil, reports the progress of the upload to an
+	// UploadProgressUpdater.
+	tracker *uploadProgress
+}
+
+// chunkRetry configures how the upload of a chunk is retried. Zero fields
+// select the package defaults.
+type chunkRetry struct {
+	deadline    time.Duration
+	backoff     *googleapi.RetryConfig // only the delays are used
+	shouldRetry func(status int, err error) bool
+}
+
+// chunkRetryFromOptions returns the chunkRetry set by opts.
+func chunkRetryFromOptions(opts *googleapi.MediaOptions) chunkRetry {
+	cr := chunkRetry{
+		deadline:    opts.ChunkRetryDeadline,
+		shouldRetry: opts.ChunkShouldRetry,
+	}
+	if opts.ChunkRetryInitialDelay > 0 || opts.ChunkRetryMaxDelay > 0 || opts.ChunkRetryMultiplier > 0 {
+		cr.backoff = &googleapi.RetryConfig{
+			InitialDelay: opts.ChunkRetryInitialDelay,
+			MaxDelay:     opts.ChunkRetryMaxDelay,
+			Multiplier:   opts.ChunkRetryMultiplier,
+		}
+	}
+	return cr
+}
+
+func (cr chunkRetry) newBackoff() Backoff {
+	if cr.backoff == nil {
+		return backoff()
+	}
+	return retryBackoff(cr.backoff)
+}
+
+// quitAfter returns a channel that receives when a chunk should no longer be
+// retried.
+func (cr chunkRetry) quitAfter() <-chan time.Time {
+	if cr.deadline > 0 {
+		return time.After(cr.deadline)
+	}
+	return time.After(retryDeadline)
+}
+
+func (cr chunkRetry) retryable(status int, err error) bool {
+	if cr.shouldRetry != nil {
+		return cr.shouldRetry(status, err)
+	}
+	return shouldRetry(status, err)
+}
+
+// resumeSource holds the media of an upload resumed from a saved session.
+type resumeSource struct {
+	r         io.ReaderAt
+	size      int64
+	chunkSize int
 }
 
 // Progress returns the number of bytes uploaded at this point.
@@ -75,6 +152,9 @@ func (rx *ResumableUpload) doUploadRequest(ctx context.Context, data io.Reader,
 	if err != nil {
 		return nil, err
 	}
+	if size > 0 && rx.tracker.active() {
+		req.Body = ioutil.NopCloser(rx.tracker.sendReader(data, off))
+	}
 
 	req.ContentLength = size
 	var contentRange string
@@ -88,6 +168,9 @@ func (rx *ResumableUpload) doUploadRequest(ctx context.Context, data io.Reader,
 		contentRange = fmt.Sprintf("bytes %v-%v/*", off, off+size-1)
 	}
 	req.Header.Set("Content-Range", contentRange)
+	if final && rx.hash != nil {
+		req.Header.Set("X-Goog-Hash", rx.hash.header())
+	}
 	req.Header.Set("Content-Type", rx.MediaType)
 	req.Header.Set("User-Agent", rx.UserAgent)
 
@@ -109,6 +192,109 @@ func statusResumeIncomplete(resp *http.Response) bool {
 	return resp != nil && resp.Header.Get("X-Http-Status-Code-Override") == "308"
 }
 
+// updateSession calls a user-supplied callback with the current session.
+func (rx *ResumableUpload) updateSession() {
+	if rx.SessionUpdater == nil {
+		return
+	}
+	rx.SessionUpdater(&googleapi.UploadSession{
+		URI:       rx.URI,
+		Offset:    rx.Media.off,
+		ChunkSize: rx.Media.chunkSize,
+		MediaType: rx.MediaType,
+	})
+}
+
+// doStatusRequest asks the server how much of the media of the upload it
+// has, with an empty request whose Content-Range gives the size of the media.
+func (rx *ResumableUpload) doStatusRequest(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequest("PUT", rx.URI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = 0
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%v", rx.resume.size))
+	req.Header.Set("User-Agent", rx.UserAgent)
+	// See the comment in doUploadRequest.
+	req.Header.Set("X-GUploader-No-308", "yes")
+	return SendRequest(ctx, rx.Client, req)
+}
+
+// resumeMedia asks the server how much of the media of a resumed upload it
+// has, and sets rx.Media to the rest of the media. If the server reports that
+// the upload is complete, or fails with an error that should not be retried,
+// resumeMedia returns its response, which the caller must close.
+func (rx *ResumableUpload) resumeMedia(ctx context.Context) (*http.Response, error) {
+	var (
+		pause time.Duration
+		err   error
+	)
+	bo := rx.retry.newBackoff()
+	quitAfter := rx.retry.quitAfter()
+	for {
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return nil, err
+		case <-quitAfter:
+			return nil, err
+		case <-time.After(pause):
+		}
+		var res *http.Response
+		res, err = rx.doStatusRequest(ctx)
+		var status int
+		if res != nil {
+			status = res.StatusCode
+		}
+		if !rx.retry.retryable(status, err) {
+			if err != nil {
+				return nil, err
+			}
+			if !statusResumeIncomplete(res) && res.StatusCode != 308 {
+				return res, nil
+			}
+			off, err := committedBytes(res.Header.Get("Range"))
+			res.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			if off > rx.resume.size {
+				return nil, fmt.Errorf("gensupport: server has %d bytes of a %d byte upload", off, rx.resume.size)
+			}
+			rx.Media = NewMediaBuffer(rx.tracker.sourceReader(io.NewSectionReader(rx.resume.r, off, rx.resume.size-off)), rx.resume.chunkSize)
+			rx.Media.off = off
+			rx.tracker.resumed(off)
+			rx.reportProgress(0, off)
+			return nil, nil
+		}
+		if err == nil {
+			err = googleapi.CheckResponse(res)
+			res.Body.Close()
+		}
+		pause = bo.Pause()
+	}
+}
+
+// committedBytes returns the number of bytes that the server has, according
+// to the Range header of a "resume incomplete" response, such as "bytes=0-42".
+// There is no Range header if the server has no bytes.
+func committedBytes(rangeHeader string) (int64, error) {
+	if rangeHeader == "" {
+		return 0, nil
+	}
+	i := strings.Index(rangeHeader, "-")
+	if !strings.HasPrefix(rangeHeader, "bytes=0-") || i < 0 {
+		return 0, fmt.Errorf("gensupport: unexpected Range header %q", rangeHeader)
+	}
+	last, err := strconv.ParseInt(rangeHeader[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gensupport: unexpected Range header %q", rangeHeader)
+	}
+	return last + 1, nil
+}
+
 // reportProgress calls a user-supplied callback to report upload progress.
 // If old==updated, the callback is not called.
 func (rx *ResumableUpload) reportProgress(old, updated int64) {
@@ -118,6 +304,7 @@ func (rx *ResumableUpload) reportProgress(old, updated int64) {
 	rx.mu.Lock()
 	rx.progress = updated
 	rx.mu.Unlock()
+	rx.tracker.committed(updated)
 	if rx.Callback != nil {
 		rx.Callback(updated)
 	}
@@ -132,6 +319,7 @@ func (rx *ResumableUpload) transferChunk(ctx context.Context) (*http.Response, e
 		return nil, err
 	}
 
+	start := time.Now()
 	res, err := rx.doUploadRequest(ctx, chunk, off, int64(size), done)
 	if err != nil {
 		return res, err
@@ -148,7 +336,14 @@ func (rx *ResumableUpload) transferChunk(ctx context.Context) (*http.Response, e
 	}
 
 	if statusResumeIncomplete(res) {
+		rx.Media.adapt(size, time.Since(start))
 		rx.Media.Next()
+		rx.updateSession()
+		rx.tracker.nextChunk()
+	} else if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated {
+		// The upload is complete.
+		rx.Media.release()
+		rx.tracker.finish()
 	}
 	return res, nil
 }
@@ -168,6 +363,9 @@ func (rx *ResumableUpload) Upload(ctx context.Context) (resp *http.Response, err
 	// one of resp and err will be non-nil. This means that any response body
 	// must be closed here before returning a non-nil error.
 	var prepareReturn = func(resp *http.Response, err error) (*http.Response, error) {
+		if rx.Media != nil {
+			rx.Media.stop()
+		}
 		if err != nil {
 			if resp != nil && resp.Body != nil {
 				resp.Body.Close()
@@ -177,13 +375,21 @@ func (rx *ResumableUpload) Upload(ctx context.Context) (resp *http.Response, err
 		return resp, nil
 	}
 
+	rx.tracker.begin()
+	if rx.Media == nil && rx.resume != nil {
+		if resp, err := rx.resumeMedia(ctx); resp != nil || err != nil {
+			return prepareReturn(resp, err)
+		}
+	}
+	rx.updateSession()
+
 	// Send all chunks.
 	for {
 		var pause time.Duration
 
 		// Each chunk gets its own initialized-at-zero retry.
-		bo := backoff()
-		quitAfter := time.After(retryDeadline)
+		bo := rx.retry.newBackoff()
+		quitAfter := rx.retry.quitAfter()
 
 		// Retry loop for a single chunk.
 		for {
@@ -206,11 +412,12 @@ func (rx *ResumableUpload) Upload(ctx context.Context) (resp *http.Response, err
 			}
 
 			// Check if we should retry the request.
-			if !shouldRetry(status, err) {
+			if !rx.retry.retryable(status, err) {
 				break
 			}
 
 			pause = bo.Pause()
+			rx.tracker.retry()
 			if resp != nil && resp.Body != nil {
 				resp.Body.Close()
 			}
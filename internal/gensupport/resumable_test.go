@@ -10,10 +10,14 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"google.golang.org/api/googleapi"
 )
 
 type unexpectedReader struct{}
@@ -301,6 +305,59 @@ func TestCancelUploadBasic(t *testing.T) {
 	}
 }
 
+// slowReader reads its media a few bytes at a time, and counts the reads made
+// after done is set.
+type slowReader struct {
+	mu    sync.Mutex
+	r     io.Reader
+	done  bool
+	after int
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		r.after++
+	}
+	if len(b) > 10 {
+		b = b[:10]
+	}
+	return r.r.Read(b)
+}
+
+func TestCancelUploadReadAhead(t *testing.T) {
+	const chunkSize = 90
+	srv := &uploadServer{t: t}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	media := &slowReader{r: strings.NewReader(strings.Repeat("a", 10*chunkSize))}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rx := &ResumableUpload{
+		Client:    ts.Client(),
+		URI:       ts.URL,
+		Media:     newMediaBuffer(media, &googleapi.MediaOptions{ChunkSize: chunkSize, ReadAhead: true}),
+		MediaType: "text/plain",
+		Callback:  func(int64) { cancel() },
+	}
+	if _, err := rx.Upload(ctx); err == nil {
+		t.Fatal("Upload: got nil, want error")
+	}
+	media.mu.Lock()
+	media.done = true
+	media.mu.Unlock()
+	// Give a read-ahead that outlived the upload the time to read.
+	time.Sleep(50 * time.Millisecond)
+	media.mu.Lock()
+	defer media.mu.Unlock()
+	if media.after != 0 {
+		t.Errorf("%d reads of the media after Upload returned, want 0", media.after)
+	}
+}
+
 func TestRetry_EachChunkHasItsOwnRetryDeadline(t *testing.T) {
 	const (
 		chunkSize = 90
@@ -364,3 +421,225 @@ func TestRetry_EachChunkHasItsOwnRetryDeadline(t *testing.T) {
 		}
 	}
 }
+
+func TestChunkRetryOptions(t *testing.T) {
+	newUpload := func(tr *interruptibleTransport, opts ...googleapi.MediaOption) *ResumableUpload {
+		return &ResumableUpload{
+			Client:    &http.Client{Transport: tr},
+			Media:     NewMediaBuffer(strings.NewReader(strings.Repeat("a", 100)), 100),
+			MediaType: "text/plain",
+			retry:     chunkRetryFromOptions(googleapi.ProcessMediaOptions(opts)),
+		}
+	}
+
+	// The predicate replaces the default one.
+	var calls []int
+	tr := &interruptibleTransport{
+		events: []event{{"bytes 0-99/*", http.StatusServiceUnavailable}},
+		bodies: bodyTracker{},
+	}
+	rx := newUpload(tr, googleapi.ChunkRetryFunc(func(status int, err error) bool {
+		calls = append(calls, status)
+		return false
+	}))
+	res, err := rx.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || !reflect.DeepEqual(calls, []int{http.StatusServiceUnavailable}) {
+		t.Errorf("got status %d and predicate calls %v, want 503 without retries", res.StatusCode, calls)
+	}
+
+	// The backoff is built from the delays of the option.
+	oldRetryBackoff := retryBackoff
+	var gotBackoff *googleapi.RetryConfig
+	retryBackoff = func(rc *googleapi.RetryConfig) Backoff {
+		gotBackoff = rc
+		return new(NoPauseBackoff)
+	}
+	defer func() { retryBackoff = oldRetryBackoff }()
+	tr = &interruptibleTransport{
+		events: []event{
+			{"bytes 0-99/*", http.StatusServiceUnavailable},
+			{"bytes 0-99/*", 308},
+			{"bytes */100", http.StatusOK},
+		},
+		bodies: bodyTracker{},
+	}
+	rx = newUpload(tr, googleapi.ChunkRetryBackoff(time.Millisecond, time.Second, 3))
+	if res, err = rx.Upload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want 200", res.StatusCode)
+	}
+	want := &googleapi.RetryConfig{InitialDelay: time.Millisecond, MaxDelay: time.Second, Multiplier: 3}
+	if !reflect.DeepEqual(gotBackoff, want) {
+		t.Errorf("got backoff config %+v, want %+v", gotBackoff, want)
+	}
+
+	// The deadline stops retries sooner than the default.
+	oldBackoff := backoff
+	backoff = func() Backoff { return new(PauseOneSecond) }
+	defer func() { backoff = oldBackoff }()
+	tr = &interruptibleTransport{
+		events: []event{
+			{"bytes 0-99/*", http.StatusServiceUnavailable},
+			{"bytes 0-99/*", http.StatusServiceUnavailable},
+		},
+		bodies: bodyTracker{},
+	}
+	rx = newUpload(tr, googleapi.ChunkRetryDeadline(10*time.Millisecond))
+	if res, err = rx.Upload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(tr.events) != 1 {
+		t.Errorf("sent %d requests, want 1", 2-len(tr.events))
+	}
+}
+
+func TestChunkRetryFromMediaInfo(t *testing.T) {
+	mi := NewInfoFromMedia(strings.NewReader(strings.Repeat("a", 2*googleapi.MinUploadChunkSize)), []googleapi.MediaOption{
+		googleapi.ChunkSize(googleapi.MinUploadChunkSize),
+		googleapi.ChunkRetryDeadline(time.Minute),
+	})
+	rx := mi.ResumableUpload("https://example.com/upload")
+	if rx == nil || rx.retry.deadline != time.Minute {
+		t.Errorf("got ResumableUpload %+v, want one with a retry deadline of 1m", rx)
+	}
+}
+
+// uploadServer is a resumable upload endpoint that keeps the media it has
+// received in buf.
+type uploadServer struct {
+	t      *testing.T
+	buf    []byte
+	ranges []string // Content-Range headers received
+}
+
+func (s *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cr := r.Header.Get("Content-Range")
+	s.ranges = append(s.ranges, r.Method+" "+cr)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	var start, end int64
+	total := "*"
+	if strings.HasPrefix(cr, "bytes */") {
+		total = strings.TrimPrefix(cr, "bytes */")
+	} else if _, err := fmt.Sscanf(strings.Replace(cr, "/", " ", 1), "bytes %d-%d %s", &start, &end, &total); err != nil || start != int64(len(s.buf)) {
+		http.Error(w, "bad Content-Range "+cr, http.StatusBadRequest)
+		return
+	}
+	s.buf = append(s.buf, body...)
+	if total == fmt.Sprint(len(s.buf)) {
+		w.Write([]byte(`{"done":true}`))
+		return
+	}
+	if len(s.buf) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.buf)-1))
+	}
+	w.Header().Set("X-Http-Status-Code-Override", "308")
+}
+
+func TestResumeUploadSession(t *testing.T) {
+	oldBackoff := backoff
+	backoff = func() Backoff { return new(NoPauseBackoff) }
+	defer func() { backoff = oldBackoff }()
+
+	data := strings.Repeat("0123456789", 5)
+	srv := &uploadServer{t: t}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// Start an upload, and give up after two chunks.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var sessions []googleapi.UploadSession
+	rx := &ResumableUpload{
+		Client:    ts.Client(),
+		URI:       ts.URL,
+		Media:     NewMediaBuffer(strings.NewReader(data), 10),
+		MediaType: "text/plain",
+		SessionUpdater: func(s *googleapi.UploadSession) {
+			sessions = append(sessions, *s)
+			if s.Offset == 20 {
+				cancel()
+			}
+		},
+	}
+	if _, err := rx.Upload(ctx); err != context.Canceled {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	want := []googleapi.UploadSession{
+		{URI: ts.URL, Offset: 0, ChunkSize: 10, MediaType: "text/plain"},
+		{URI: ts.URL, Offset: 10, ChunkSize: 10, MediaType: "text/plain"},
+		{URI: ts.URL, Offset: 20, ChunkSize: 10, MediaType: "text/plain"},
+	}
+	if !reflect.DeepEqual(sessions, want) {
+		t.Fatalf("got sessions %+v, want %+v", sessions, want)
+	}
+
+	// The server lost some of the media; the upload resumes from what it has.
+	srv.buf = srv.buf[:15]
+	srv.ranges = nil
+	var progress []int64
+	mi := NewInfoFromUploadSession(&sessions[2], strings.NewReader(data), int64(len(data)))
+	mi.SetProgressUpdater(func(current, total int64) { progress = append(progress, current) })
+	rx = mi.ResumedUpload()
+	rx.Client = ts.Client()
+	res, err := rx.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", res.StatusCode)
+	}
+	if string(srv.buf) != data {
+		t.Errorf("server has %q, want %q", srv.buf, data)
+	}
+	wantRanges := []string{"PUT bytes */50", "POST bytes 15-24/*", "POST bytes 25-34/*", "POST bytes 35-44/*", "POST bytes 45-49/50"}
+	if !reflect.DeepEqual(srv.ranges, wantRanges) {
+		t.Errorf("got requests %q, want %q", srv.ranges, wantRanges)
+	}
+	if want := []int64{15, 25, 35, 45, 50}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("got progress %v, want %v", progress, want)
+	}
+
+	// Resuming a complete upload returns the final response.
+	rx = NewInfoFromUploadSession(&sessions[2], strings.NewReader(data), int64(len(data))).ResumedUpload()
+	rx.Client = ts.Client()
+	res, err = rx.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != `{"done":true}` {
+		t.Errorf("got body %q", body)
+	}
+}
+
+func TestCommittedBytes(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"bytes=0-0", 1, false},
+		{"bytes=0-262143", 262144, false},
+		{"bytes=10-20", 0, true},
+		{"bytes=0-x", 0, true},
+	} {
+		got, err := committedBytes(test.in)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("committedBytes(%q) = %d, %v; want %d, error: %t", test.in, got, err, test.want, test.wantErr)
+		}
+	}
+}
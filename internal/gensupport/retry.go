@@ -0,0 +1,155 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal"
+	"google.golang.org/api/option"
+)
+
+// defaultRetryCodes are the HTTP status codes retried by a RetryConfig that
+// does not list any.
+var defaultRetryCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// defaultMaxAttempts is the number of times a call is sent by a RetryConfig
+// whose MaxAttempts is zero.
+const defaultMaxAttempts = 5
+
+// retryBackoff returns the Backoff used between the attempts of a call
+// retried with rc. It is a variable so that tests can replace it.
+var retryBackoff = func(rc *googleapi.RetryConfig) Backoff {
+	bo := &gax.Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+	}
+	if rc.InitialDelay > 0 {
+		bo.Initial = rc.InitialDelay
+	}
+	if rc.MaxDelay > 0 {
+		bo.Max = rc.MaxDelay
+	}
+	if rc.Multiplier >= 1 {
+		bo.Multiplier = rc.Multiplier
+	}
+	return bo
+}
+
+// RetryConfigFromOptions returns the RetryConfig set with
+// option.WithRetryConfig in opts, or nil if there is none.
+func RetryConfigFromOptions(opts []option.ClientOption) *googleapi.RetryConfig {
+	var ds internal.DialSettings
+	for _, o := range opts {
+		o.Apply(&ds)
+	}
+	return ds.RetryConfig
+}
+
+// SendRequestWithRetryConfig sends a single HTTP request using the given
+// client, retrying it as configured by rc. If rc is nil, or selects no
+// retries for req, the request is sent once as by SendRequest.
+func SendRequestWithRetryConfig(ctx context.Context, client *http.Client, req *http.Request, rc *googleapi.RetryConfig) (*http.Response, error) {
+	// Disallow Accept-Encoding because it interferes with the automatic gzip handling
+	// done by the default http.Transport. See https://github.com/google/google-api-go-client/issues/219.
+	if _, ok := req.Header["Accept-Encoding"]; ok {
+		return nil, errors.New("google api: custom Accept-Encoding headers not allowed")
+	}
+	if ctx == nil || !retryRequest(rc, client, req) {
+		return SendRequest(ctx, client, req)
+	}
+
+	maxAttempts := rc.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	bo := retryBackoff(rc)
+	for attempt := 1; ; attempt++ {
+		resp, err := send(ctx, client, req)
+		var status int
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		if attempt >= maxAttempts || !retryable(rc, status, err) {
+			return resp, err
+		}
+
+		t := time.NewTimer(bo.Pause())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return resp, err
+		case <-t.C:
+		}
+		if req.GetBody != nil {
+			body, errBody := req.GetBody()
+			if errBody != nil {
+				return resp, err
+			}
+			req.Body = body
+		}
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// retryRequest reports whether req may be retried with rc.
+func retryRequest(rc *googleapi.RetryConfig, client *http.Client, req *http.Request) bool {
+	if rc == nil || rc.MaxAttempts == 1 {
+		return false
+	}
+	// A request with a body can only be retried if the body can be recreated.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	// The parts of a batch request can't be sent more than once.
+	if client != nil {
+		if _, ok := client.Transport.(*batchPart); ok {
+			return false
+		}
+	}
+	switch rc.Policy {
+	case googleapi.RetryAlways:
+		return true
+	case googleapi.RetryIdempotent:
+		switch req.Method {
+		case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+			return true
+		}
+	}
+	return false
+}
+
+// retryable reports whether a response with the given status, or the given
+// error, should be retried with rc.
+func retryable(rc *googleapi.RetryConfig, status int, err error) bool {
+	if err != nil {
+		return shouldRetry(0, err)
+	}
+	codes := rc.Codes
+	if len(codes) == 0 {
+		codes = defaultRetryCodes
+	}
+	for _, c := range codes {
+		if c == status {
+			return true
+		}
+	}
+	return false
+}
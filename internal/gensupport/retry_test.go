@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// failingHandler answers the first failures requests with status, and later
+// ones with 200. It records the body of every request.
+type failingHandler struct {
+	status   int
+	failures int
+	bodies   []string
+}
+
+func (h *failingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	h.bodies = append(h.bodies, string(b))
+	if len(h.bodies) <= h.failures {
+		w.WriteHeader(h.status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestSendRequestWithRetryConfig(t *testing.T) {
+	oldBackoff := retryBackoff
+	defer func() { retryBackoff = oldBackoff }()
+	retryBackoff = func(*googleapi.RetryConfig) Backoff { return new(NoPauseBackoff) }
+
+	for _, test := range []struct {
+		desc         string
+		method       string
+		rc           *googleapi.RetryConfig
+		status       int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{"no config", "GET", nil, 503, 1, 503},
+		{"default", "GET", &googleapi.RetryConfig{}, 503, 3, 200},
+		{"not retryable status", "GET", &googleapi.RetryConfig{}, 404, 1, 404},
+		{"custom codes", "GET", &googleapi.RetryConfig{Codes: []int{429}}, 503, 1, 503},
+		{"custom codes match", "GET", &googleapi.RetryConfig{Codes: []int{429}}, 429, 3, 200},
+		{"max attempts", "GET", &googleapi.RetryConfig{MaxAttempts: 2}, 503, 2, 503},
+		{"non-idempotent", "POST", &googleapi.RetryConfig{}, 503, 1, 503},
+		{"retry always", "POST", &googleapi.RetryConfig{Policy: googleapi.RetryAlways}, 503, 3, 200},
+		{"retry never", "GET", &googleapi.RetryConfig{Policy: googleapi.RetryNever}, 503, 1, 503},
+	} {
+		h := &failingHandler{status: test.status, failures: 2}
+		srv := httptest.NewServer(h)
+		req, _ := http.NewRequest(test.method, srv.URL, strings.NewReader("body"))
+		res, err := SendRequestWithRetryConfig(context.Background(), srv.Client(), req, test.rc)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != test.wantStatus {
+			t.Errorf("%s: got status %d, want %d", test.desc, res.StatusCode, test.wantStatus)
+		}
+		if len(h.bodies) != test.wantAttempts {
+			t.Errorf("%s: got %d attempts, want %d", test.desc, len(h.bodies), test.wantAttempts)
+		}
+		for i, b := range h.bodies {
+			if b != "body" {
+				t.Errorf("%s: attempt %d: got body %q, want %q", test.desc, i+1, b, "body")
+			}
+		}
+	}
+}
+
+func TestSendRequestWithRetryConfigDefaultMaxAttempts(t *testing.T) {
+	oldBackoff := retryBackoff
+	defer func() { retryBackoff = oldBackoff }()
+	retryBackoff = func(*googleapi.RetryConfig) Backoff { return new(NoPauseBackoff) }
+
+	h := &failingHandler{status: 503, failures: 100}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	res, err := SendRequestWithRetryConfig(context.Background(), srv.Client(), req, &googleapi.RetryConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 503 {
+		t.Errorf("got status %d, want 503", res.StatusCode)
+	}
+	if len(h.bodies) != defaultMaxAttempts {
+		t.Errorf("got %d attempts, want %d", len(h.bodies), defaultMaxAttempts)
+	}
+}
+
+func TestSendRequestWithRetryConfigCanceled(t *testing.T) {
+	h := &failingHandler{status: 503, failures: 100}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	oldBackoff := retryBackoff
+	defer func() { retryBackoff = oldBackoff }()
+	retryBackoff = func(*googleapi.RetryConfig) Backoff {
+		cancel()
+		return new(NoPauseBackoff)
+	}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	res, err := SendRequestWithRetryConfig(ctx, srv.Client(), req, &googleapi.RetryConfig{})
+	if err == nil {
+		res.Body.Close()
+	}
+	if len(h.bodies) > 2 {
+		t.Errorf("got %d attempts after cancellation, want at most 2", len(h.bodies))
+	}
+}
+
+func TestRetryConfigFromOptions(t *testing.T) {
+	rc := &googleapi.RetryConfig{MaxAttempts: 5}
+	opts := []option.ClientOption{option.WithUserAgent("ua"), option.WithRetryConfig(rc)}
+	if got := RetryConfigFromOptions(opts); got != rc {
+		t.Errorf("got %v, want %v", got, rc)
+	}
+	if got := RetryConfigFromOptions(opts[:1]); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+}
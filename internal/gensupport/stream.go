@@ -0,0 +1,90 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DecodeResponseStream decodes the JSON object in the body of res into
+// target, like DecodeResponse, except for the array held by the member named
+// items. The elements of that array are handed to f one at a time as they are
+// read, so that the array is never held in memory: f is called with a
+// function that decodes the current element into a value. The other members
+// of the object are decoded into target once the whole body has been read. If
+// f returns an error, decoding stops and that error is returned.
+//
+// If there is no body, target is unchanged and f is not called.
+func DecodeResponseStream(target interface{}, res *http.Response, items string, f func(decode func(v interface{}) error) error) error {
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	dec := json.NewDecoder(res.Body)
+	if err := readDelim(dec, '{'); err != nil {
+		return err
+	}
+	rest := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string) // object keys are always strings
+		if key != items {
+			var v json.RawMessage
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			rest[key] = v
+			continue
+		}
+		if err := decodeArrayStream(dec, key, f); err != nil {
+			return err
+		}
+	}
+	if err := readDelim(dec, '}'); err != nil {
+		return err
+	}
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, target)
+}
+
+// decodeArrayStream calls f for each element of the array that is the next
+// value in dec. A null value is treated as an empty array.
+func decodeArrayStream(dec *json.Decoder, key string, f func(decode func(v interface{}) error) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("gensupport: member %q of response is not an array", key)
+	}
+	for dec.More() {
+		if err := f(dec.Decode); err != nil {
+			return err
+		}
+	}
+	return readDelim(dec, ']')
+}
+
+// readDelim reads the next token from dec, which must be the delimiter d.
+func readDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("gensupport: got %v in response, want %v", tok, d)
+	}
+	return nil
+}
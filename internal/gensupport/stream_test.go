@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type streamItem struct {
+	Name string `json:"name,omitempty"`
+}
+
+type streamResponse struct {
+	Items         []*streamItem `json:"items,omitempty"`
+	NextPageToken string        `json:"nextPageToken,omitempty"`
+	Total         int64         `json:"total,omitempty,string"`
+}
+
+func streamHTTPResponse(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestDecodeResponseStream(t *testing.T) {
+	for _, test := range []struct {
+		body      string
+		wantNames []string
+		want      streamResponse
+	}{
+		{
+			body:      `{"nextPageToken": "t", "items": [{"name": "a"}, {"name": "b"}], "total": "7"}`,
+			wantNames: []string{"a", "b"},
+			want:      streamResponse{NextPageToken: "t", Total: 7},
+		},
+		{
+			body: `{"items": null, "nextPageToken": "t"}`,
+			want: streamResponse{NextPageToken: "t"},
+		},
+		{
+			body: `{}`,
+		},
+	} {
+		var (
+			got   streamResponse
+			names []string
+		)
+		err := DecodeResponseStream(&got, streamHTTPResponse(200, test.body), "items", func(decode func(interface{}) error) error {
+			var item *streamItem
+			if err := decode(&item); err != nil {
+				return err
+			}
+			names = append(names, item.Name)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.body, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, test.wantNames) {
+			t.Errorf("%s: got items %q, want %q", test.body, names, test.wantNames)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.body, got, test.want)
+		}
+	}
+}
+
+func TestDecodeResponseStreamErrors(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+	var got streamResponse
+	err := DecodeResponseStream(&got, streamHTTPResponse(200, `{"items": [{"name": "a"}, {"name": "b"}]}`), "items", func(decode func(interface{}) error) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("got %v after %d calls, want %v after 1", err, calls, errStop)
+	}
+
+	for _, body := range []string{
+		`[]`,
+		`{"items": {"name": "a"}}`,
+		`{"items": [{"name": "a"}`,
+	} {
+		err := DecodeResponseStream(&got, streamHTTPResponse(200, body), "items", func(decode func(interface{}) error) error {
+			var item streamItem
+			return decode(&item)
+		})
+		if err == nil {
+			t.Errorf("%s: got nil, want error", body)
+		}
+	}
+
+	if err := DecodeResponseStream(&got, streamHTTPResponse(http.StatusNoContent, ""), "items", nil); err != nil {
+		t.Errorf("no content: %v", err)
+	}
+}
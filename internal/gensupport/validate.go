@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"google.golang.org/api/googleapi"
+)
+
+// A Validator collects the violations of the constraints on the parameters
+// of an API call. It is used by the generated Validate methods.
+type Validator struct {
+	method string
+	errs   []googleapi.ParamError
+}
+
+// NewValidator returns a Validator for a call of the API method with the
+// given ID.
+func NewValidator(method string) *Validator {
+	return &Validator{method: method}
+}
+
+func (v *Validator) add(param, value, format string, args ...interface{}) {
+	v.errs = append(v.errs, googleapi.ParamError{
+		Param:   param,
+		Value:   value,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Required checks that the required parameter has a non-empty value.
+func (v *Validator) Required(param, value string) {
+	if value == "" {
+		v.add(param, value, "is required")
+	}
+}
+
+// patterns caches compiled parameter patterns by their source.
+var patterns sync.Map // map[string]*regexp.Regexp
+
+// Pattern checks that each value of the parameter matches pattern. Values
+// that are empty are not checked; an invalid pattern matches all values.
+func (v *Validator) Pattern(param, pattern string, values ...string) {
+	re, ok := patterns.Load(pattern)
+	if !ok {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return
+		}
+		re, _ = patterns.LoadOrStore(pattern, r)
+	}
+	for _, val := range values {
+		if val != "" && !re.(*regexp.Regexp).MatchString(val) {
+			v.add(param, val, "does not match %q", pattern)
+		}
+	}
+}
+
+// Enum checks that each value of the parameter is one of allowed.
+func (v *Validator) Enum(param string, allowed []string, values ...string) {
+	for _, val := range values {
+		found := false
+		for _, a := range allowed {
+			if val == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.add(param, val, "is not one of %q", allowed)
+		}
+	}
+}
+
+// Range checks that each value of the numeric parameter is at least min
+// and at most max. An empty bound is not checked.
+func (v *Validator) Range(param, min, max string, values ...string) {
+	for _, val := range values {
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			v.add(param, val, "is not a number")
+			continue
+		}
+		if lo, err := strconv.ParseFloat(min, 64); err == nil && n < lo {
+			v.add(param, val, "must be at least %s", min)
+		}
+		if hi, err := strconv.ParseFloat(max, 64); err == nil && n > hi {
+			v.add(param, val, "must be at most %s", max)
+		}
+	}
+}
+
+// Err returns a *googleapi.ValidationError listing the violations found so
+// far, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &googleapi.ValidationError{Method: v.method, Errors: v.errs}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestValidator(t *testing.T) {
+	v := NewValidator("test.items.list")
+	if err := v.Err(); err != nil {
+		t.Fatalf("no checks: got %v, want nil", err)
+	}
+	v.Required("name", "projects/p")
+	v.Pattern("name", "^projects/[^/]+$", "projects/p")
+	v.Enum("view", []string{"BASIC", "FULL"}, "FULL")
+	v.Range("pageSize", "0", "1000", "50")
+	if err := v.Err(); err != nil {
+		t.Fatalf("valid values: got %v, want nil", err)
+	}
+
+	v.Required("parent", "")
+	v.Pattern("name", "^projects/[^/]+$", "folders/f")
+	v.Pattern("name", "(?!lookahead)", "anything")
+	v.Enum("view", []string{"BASIC", "FULL"}, "BASIC", "PARTIAL")
+	v.Range("pageSize", "1", "1000", "0", "1001", "ten")
+	v.Range("offset", "", "5", "-10")
+	err, ok := v.Err().(*googleapi.ValidationError)
+	if !ok {
+		t.Fatalf("got %T, want *googleapi.ValidationError", v.Err())
+	}
+	want := &googleapi.ValidationError{
+		Method: "test.items.list",
+		Errors: []googleapi.ParamError{
+			{Param: "parent", Value: "", Message: "is required"},
+			{Param: "name", Value: "folders/f", Message: `does not match "^projects/[^/]+$"`},
+			{Param: "view", Value: "PARTIAL", Message: `is not one of ["BASIC" "FULL"]`},
+			{Param: "pageSize", Value: "0", Message: "must be at least 1"},
+			{Param: "pageSize", Value: "1001", Message: "must be at most 1000"},
+			{Param: "pageSize", Value: "ten", Message: "is not a number"},
+		},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("got  %+v\nwant %+v", err, want)
+	}
+	if got, want := err.Error(), `googleapi: invalid parameters for test.items.list: parent "" is required; name "folders/f" does not match "^projects/[^/]+$"; view "PARTIAL" is not one of ["BASIC" "FULL"]; pageSize "0" must be at least 1; pageSize "1001" must be at most 1000; pageSize "ten" is not a number`; got != want {
+		t.Errorf("Error():\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MarshalVariant returns the JSON object encoding of v, a member of a variant
+// schema, with its discriminant property set to value. It is used by the
+// generated Set methods of variant types.
+func MarshalVariant(v interface{}, discriminant, value string) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as they are, rather than converting them to float64.
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	m[discriminant] = value
+	return m, nil
+}
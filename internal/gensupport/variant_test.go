@@ -0,0 +1,39 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type variantPoint struct {
+	Type        string    `json:"type,omitempty"`
+	Coordinates []float64 `json:"coordinates,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+}
+
+func TestMarshalVariant(t *testing.T) {
+	for _, test := range []struct {
+		in   interface{}
+		want string
+	}{
+		{&variantPoint{Coordinates: []float64{1, 2}}, `{"coordinates":[1,2],"type":"Point"}`},
+		{&variantPoint{Type: "Line", Size: 1 << 60}, `{"size":1152921504606846976,"type":"Point"}`},
+		{(*variantPoint)(nil), `{"type":"Point"}`},
+	} {
+		m, err := MarshalVariant(test.in, "type", "Point")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%+v: got %s, want %s", test.in, got, test.want)
+		}
+	}
+}
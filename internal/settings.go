@@ -12,6 +12,7 @@ import (
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/internal/impersonate"
 	"google.golang.org/grpc"
 )
@@ -45,6 +46,7 @@ type DialSettings struct {
 	SkipValidation      bool
 	ImpersonationConfig *impersonate.Config
 	EnableDirectPath    bool
+	RetryConfig         *googleapi.RetryConfig
 
 	// Google API system parameters. For more information please read:
 	// https://cloud.google.com/apis/docs/system-parameters
@@ -10,6 +10,7 @@ import (
 	"net/http"
 
 	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/internal"
 	"google.golang.org/api/internal/impersonate"
 	"google.golang.org/grpc"
@@ -239,6 +240,20 @@ func (w withTelemetryDisabled) Apply(o *internal.DialSettings) {
 	o.TelemetryDisabled = true
 }
 
+// WithRetryConfig returns a ClientOption that sets how the calls of a
+// service are retried when they fail. It applies to every call that does not
+// set its own configuration with its Retryer method. This option may only be
+// used with services that support HTTP as their communication transport.
+func WithRetryConfig(rc *googleapi.RetryConfig) ClientOption {
+	return withRetryConfig{rc}
+}
+
+type withRetryConfig struct{ rc *googleapi.RetryConfig }
+
+func (w withRetryConfig) Apply(o *internal.DialSettings) {
+	o.RetryConfig = w.rc
+}
+
 // ClientCertSource is a function that returns a TLS client certificate to be used
 // when opening TLS connections.
 //
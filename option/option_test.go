@@ -13,6 +13,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/internal"
 	"google.golang.org/grpc"
 )
@@ -73,6 +74,7 @@ func TestApply(t *testing.T) {
 		WithQuotaProject("user-project"),
 		WithRequestReason("Request Reason"),
 		WithTelemetryDisabled(),
+		WithRetryConfig(&googleapi.RetryConfig{MaxAttempts: 3}),
 	}
 	var got internal.DialSettings
 	for _, opt := range opts {
@@ -91,6 +93,7 @@ func TestApply(t *testing.T) {
 		QuotaProject:      "user-project",
 		RequestReason:     "Request Reason",
 		TelemetryDisabled: true,
+		RetryConfig:       &googleapi.RetryConfig{MaxAttempts: 3},
 	}
 	if !cmp.Equal(got, want, cmpopts.IgnoreUnexported(grpc.ClientConn{})) {
 		t.Errorf(cmp.Diff(got, want, cmpopts.IgnoreUnexported(grpc.ClientConn{})))
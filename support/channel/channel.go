@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package channel receives the push notifications that APIs such as Drive,
+// Calendar, Admin SDK and Gmail send to a channel opened by one of their
+// watch methods.
+//
+// A Handler is an http.Handler for the address of the channels. It checks
+// that each notification is for a known, unexpired channel and carries its
+// token, drops notifications that were already delivered, and passes the
+// others to the function registered for their resource state:
+//
+//	h := channel.NewHandler()
+//	h.Handle(channel.Change, func(e *channel.Event) error {
+//		log.Printf("resource %s changed", e.ResourceID)
+//		return nil
+//	})
+//	http.Handle("/notifications", h)
+//
+// Channels expire. A Renewer opens a channel with a watch call, adds it to a
+// Handler, and replaces it with a new one before it expires:
+//
+//	r := &channel.Renewer{
+//		Handler: h,
+//		Watch: func(ctx context.Context, id, token string) (*channel.Channel, error) {
+//			ch, err := svc.Changes.Watch(pageToken, &drive.Channel{
+//				Id:      id,
+//				Token:   token,
+//				Type:    "web_hook",
+//				Address: "https://example.com/notifications",
+//			}).Context(ctx).Do()
+//			if err != nil {
+//				return nil, err
+//			}
+//			return channel.FromAPI(ch)
+//		},
+//		Stop: func(ctx context.Context, ch *channel.Channel) error {
+//			return svc.Channels.Stop(&drive.Channel{Id: ch.ID, ResourceId: ch.ResourceID}).Context(ctx).Do()
+//		},
+//	}
+//	go r.Run(ctx)
+//
+// This package is experimental and subject to change without notice.
+package channel
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// A Channel is a notification channel opened by a watch call.
+type Channel struct {
+	// ID is the ID of the channel, chosen by the caller of the watch method.
+	ID string
+	// ResourceID identifies the watched resource. It is set by the API.
+	ResourceID string
+	// Token is sent with every notification on the channel.
+	Token string
+	// Expiration is when the channel stops sending notifications. It is zero
+	// if the channel does not expire.
+	Expiration time.Time
+}
+
+// FromAPI returns the Channel described by a Channel value of a generated API
+// package, such as a *drive.Channel returned by a watch call.
+func FromAPI(v interface{}) (*Channel, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("channel: FromAPI of nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("channel: FromAPI of %T, want a pointer to a Channel struct", v)
+	}
+	str := func(name string) string {
+		if f := rv.FieldByName(name); f.IsValid() && f.Kind() == reflect.String {
+			return f.String()
+		}
+		return ""
+	}
+	ch := &Channel{
+		ID:         str("Id"),
+		ResourceID: str("ResourceId"),
+		Token:      str("Token"),
+	}
+	if ch.ID == "" {
+		return nil, fmt.Errorf("channel: %T has no channel ID", v)
+	}
+	// The expiration is in milliseconds since the epoch. Most APIs give it
+	// as an int64, but some give it as a string.
+	var ms int64
+	switch f := rv.FieldByName("Expiration"); {
+	case !f.IsValid():
+	case f.Kind() == reflect.Int64:
+		ms = f.Int()
+	case f.Kind() == reflect.String && f.String() != "":
+		n, err := strconv.ParseInt(f.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("channel: bad expiration %q: %v", f.String(), err)
+		}
+		ms = n
+	}
+	if ms > 0 {
+		ch.Expiration = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return ch, nil
+}
+
+// A ResourceState is the kind of a notification, given by its
+// X-Goog-Resource-State header. The states an API sends depend on the watched
+// resource.
+type ResourceState string
+
+const (
+	// Sync is the state of the first notification on a new channel.
+	Sync ResourceState = "sync"
+
+	Add       ResourceState = "add"
+	Change    ResourceState = "change"
+	Exists    ResourceState = "exists"
+	NotExists ResourceState = "not_exists"
+	Remove    ResourceState = "remove"
+	Trash     ResourceState = "trash"
+	Untrash   ResourceState = "untrash"
+	Update    ResourceState = "update"
+)
+
+// An Event is a push notification.
+type Event struct {
+	ChannelID string
+	// MessageNumber increases with each notification sent on the channel,
+	// starting with 1 for the Sync notification.
+	MessageNumber int64
+	ResourceState ResourceState
+	ResourceID    string
+	ResourceURI   string
+	// Changed lists what changed in the resource, such as "content" or
+	// "properties", for the APIs that send X-Goog-Changed.
+	Changed []string
+	// Expiration is the expiration time of the channel, if it has one.
+	Expiration time.Time
+
+	// Header is the header of the notification request.
+	Header http.Header
+	// Body is the body of the notification request, which is empty for most
+	// APIs.
+	Body []byte
+}
@@ -0,0 +1,268 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package channel
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiChannel has the fields of a Channel in a generated API package.
+type apiChannel struct {
+	Address    string
+	Expiration int64
+	Id         string
+	ResourceId string
+	Token      string
+}
+
+func TestFromAPI(t *testing.T) {
+	got, err := FromAPI(&apiChannel{
+		Id:         "ch1",
+		ResourceId: "res1",
+		Token:      "tok",
+		Expiration: 1500000000123,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Channel{
+		ID:         "ch1",
+		ResourceID: "res1",
+		Token:      "tok",
+		Expiration: time.Unix(1500000000, 123*int64(time.Millisecond)),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	type stringExpiration struct {
+		Id, Expiration string
+	}
+	got, err = FromAPI(stringExpiration{Id: "ch2", Expiration: "1500000000000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1500000000, 0); !got.Expiration.Equal(want) {
+		t.Errorf("got expiration %v, want %v", got.Expiration, want)
+	}
+
+	for _, v := range []interface{}{nil, (*apiChannel)(nil), &apiChannel{}, "ch", stringExpiration{Id: "ch", Expiration: "x"}} {
+		if _, err := FromAPI(v); err == nil {
+			t.Errorf("FromAPI(%#v): got nil, want error", v)
+		}
+	}
+}
+
+var testNow = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestHandler() *Handler {
+	h := NewHandler()
+	h.now = func() time.Time { return testNow }
+	h.Add(&Channel{ID: "ch1", ResourceID: "res1", Token: "tok1", Expiration: testNow.Add(time.Hour)})
+	return h
+}
+
+// notify sends a notification to h and returns the response status.
+func notify(t *testing.T, h http.Handler, header map[string]string, body string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/notifications", strings.NewReader(body))
+	for k, v := range map[string]string{
+		"X-Goog-Channel-ID":     "ch1",
+		"X-Goog-Channel-Token":  "tok1",
+		"X-Goog-Message-Number": "1",
+		"X-Goog-Resource-ID":    "res1",
+		"X-Goog-Resource-State": "sync",
+		"X-Goog-Resource-URI":   "https://www.googleapis.com/drive/v3/changes",
+	} {
+		req.Header.Set(k, v)
+	}
+	for k, v := range header {
+		if v == "" {
+			req.Header.Del(k)
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestHandler(t *testing.T) {
+	h := newTestHandler()
+	var got []*Event
+	h.Handle(Sync, func(e *Event) error {
+		got = append(got, e)
+		return nil
+	})
+	h.Handle(Change, func(e *Event) error {
+		got = append(got, e)
+		return nil
+	})
+
+	if code := notify(t, h, nil, ""); code != http.StatusOK {
+		t.Fatalf("sync: got status %d, want 200", code)
+	}
+	code := notify(t, h, map[string]string{
+		"X-Goog-Message-Number":     "2",
+		"X-Goog-Resource-State":     "change",
+		"X-Goog-Changed":            "content, properties",
+		"X-Goog-Channel-Expiration": "Tue, 01 Jun 2021 13:00:00 GMT",
+	}, `{"kind":"drive#change"}`)
+	if code != http.StatusOK {
+		t.Fatalf("change: got status %d, want 200", code)
+	}
+	// States without a HandlerFunc are acknowledged.
+	if code := notify(t, h, map[string]string{"X-Goog-Message-Number": "3", "X-Goog-Resource-State": "remove"}, ""); code != http.StatusOK {
+		t.Errorf("remove: got status %d, want 200", code)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if e := got[0]; e.ResourceState != Sync || e.MessageNumber != 1 || e.Body != nil {
+		t.Errorf("got first event %+v", e)
+	}
+	e := got[1]
+	if e.ChannelID != "ch1" || e.ResourceID != "res1" || e.ResourceState != Change || e.MessageNumber != 2 {
+		t.Errorf("got second event %+v", e)
+	}
+	if want := []string{"content", "properties"}; !reflect.DeepEqual(e.Changed, want) {
+		t.Errorf("got Changed %q, want %q", e.Changed, want)
+	}
+	if want := testNow.Add(time.Hour); !e.Expiration.Equal(want) {
+		t.Errorf("got Expiration %v, want %v", e.Expiration, want)
+	}
+	if string(e.Body) != `{"kind":"drive#change"}` {
+		t.Errorf("got Body %q", e.Body)
+	}
+}
+
+func TestHandlerRejects(t *testing.T) {
+	h := newTestHandler()
+	called := false
+	h.Handle("", func(*Event) error {
+		called = true
+		return nil
+	})
+	for _, test := range []struct {
+		desc   string
+		header map[string]string
+		want   int
+	}{
+		{"no channel", map[string]string{"X-Goog-Channel-ID": ""}, http.StatusBadRequest},
+		{"bad message number", map[string]string{"X-Goog-Message-Number": "x"}, http.StatusBadRequest},
+		{"unknown channel", map[string]string{"X-Goog-Channel-ID": "ch2"}, http.StatusNotFound},
+		{"no token", map[string]string{"X-Goog-Channel-Token": ""}, http.StatusForbidden},
+		{"bad token", map[string]string{"X-Goog-Channel-Token": "tok2"}, http.StatusForbidden},
+		{"wrong resource", map[string]string{"X-Goog-Resource-ID": "res2"}, http.StatusForbidden},
+		{"expired", map[string]string{"X-Goog-Channel-Expiration": "Tue, 01 Jun 2021 11:00:00 GMT"}, http.StatusForbidden},
+	} {
+		if got := notify(t, h, test.header, ""); got != test.want {
+			t.Errorf("%s: got status %d, want %d", test.desc, got, test.want)
+		}
+	}
+	req := httptest.NewRequest("GET", "/notifications", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, want 405", w.Code)
+	}
+
+	// Once the channel expires, it is rejected.
+	h.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+	if got := notify(t, h, nil, ""); got != http.StatusForbidden {
+		t.Errorf("expired channel: got status %d, want 403", got)
+	}
+	h.now = func() time.Time { return testNow }
+	h.Remove("ch1")
+	if got := notify(t, h, nil, ""); got != http.StatusNotFound {
+		t.Errorf("removed channel: got status %d, want 404", got)
+	}
+	if called {
+		t.Error("HandlerFunc was called for a rejected notification")
+	}
+}
+
+func TestHandlerDedup(t *testing.T) {
+	h := newTestHandler()
+	var got []int64
+	fail := true
+	h.Handle("", func(e *Event) error {
+		if e.MessageNumber == 3 && fail {
+			fail = false
+			return errors.New("try again")
+		}
+		got = append(got, e.MessageNumber)
+		return nil
+	})
+	h.ErrorLog = log.New(ioutil.Discard, "", 0)
+	for _, test := range []struct {
+		n    string
+		want int
+	}{
+		{"1", http.StatusOK},
+		{"2", http.StatusOK},
+		{"2", http.StatusOK},
+		{"3", http.StatusInternalServerError},
+		{"3", http.StatusOK}, // redelivered after the failure
+		{"1", http.StatusOK},
+		{"5", http.StatusOK},
+		{"4", http.StatusOK}, // out of order
+		{"4", http.StatusOK},
+	} {
+		if code := notify(t, h, map[string]string{"X-Goog-Message-Number": test.n, "X-Goog-Resource-State": "update"}, ""); code != test.want {
+			t.Errorf("message %s: got status %d, want %d", test.n, code, test.want)
+		}
+	}
+	if want := []int64{1, 2, 3, 5, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled messages %v, want %v", got, want)
+	}
+}
+
+func TestHandlerServer(t *testing.T) {
+	h := newTestHandler()
+	events := make(chan *Event, 1)
+	h.Handle(Sync, func(e *Event) error {
+		events <- e
+		return nil
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, err := http.NewRequest("POST", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Goog-Channel-ID", "ch1")
+	req.Header.Set("X-Goog-Channel-Token", "tok1")
+	req.Header.Set("X-Goog-Message-Number", "1")
+	req.Header.Set("X-Goog-Resource-ID", "res1")
+	req.Header.Set("X-Goog-Resource-State", "sync")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", res.StatusCode)
+	}
+	select {
+	case e := <-events:
+		if e.ChannelID != "ch1" {
+			t.Errorf("got channel %q, want ch1", e.ChannelID)
+		}
+	default:
+		t.Error("no event was dispatched")
+	}
+}
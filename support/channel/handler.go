@@ -0,0 +1,250 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package channel
+
+import (
+	"crypto/subtle"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodySize is the largest notification body a Handler reads.
+const maxBodySize = 1 << 20
+
+// dedupWindow is how many message numbers below the highest one seen on a
+// channel are remembered. Older messages are assumed to be duplicates.
+const dedupWindow = 1000
+
+// A HandlerFunc handles an event. If it returns an error, the notification is
+// answered with a 500 status, so that the API sends it again later.
+type HandlerFunc func(*Event) error
+
+// A Handler is an http.Handler that receives push notifications for the
+// channels added to it. A notification is rejected if it is for an unknown or
+// expired channel, or if its token or resource ID does not match those of the
+// channel. Notifications that were already handled are acknowledged and
+// dropped.
+//
+// A Handler must be created with NewHandler. It is safe for concurrent use.
+type Handler struct {
+	// ErrorLog logs errors returned by HandlerFuncs. If nil, the log package's
+	// standard logger is used.
+	ErrorLog *log.Logger
+
+	now func() time.Time // for testing
+
+	mu       sync.Mutex
+	channels map[string]*channelState
+	handlers map[ResourceState]HandlerFunc
+}
+
+type channelState struct {
+	ch *Channel
+	// seen holds the message numbers that were handled, down to max-dedupWindow.
+	seen map[int64]bool
+	max  int64
+	// pending holds the message numbers being handled.
+	pending map[int64]bool
+}
+
+// NewHandler returns a Handler with no channels.
+func NewHandler() *Handler {
+	return &Handler{
+		now:      time.Now,
+		channels: make(map[string]*channelState),
+		handlers: make(map[ResourceState]HandlerFunc),
+	}
+}
+
+// Handle registers f to handle the events in state. If state is empty, f
+// handles the events of every state that has no HandlerFunc of its own.
+// Events that no HandlerFunc handles are acknowledged and dropped.
+func (h *Handler) Handle(state ResourceState, f HandlerFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[state] = f
+}
+
+// Add adds ch to the channels whose notifications h accepts. If h already has
+// a channel with the same ID, it is replaced.
+func (h *Handler) Add(ch *Channel) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := *ch
+	if cs, ok := h.channels[ch.ID]; ok {
+		cs.ch = &c
+		return
+	}
+	h.channels[ch.ID] = &channelState{
+		ch:      &c,
+		seen:    make(map[int64]bool),
+		pending: make(map[int64]bool),
+	}
+}
+
+// Remove removes the channel with the given ID from h.
+func (h *Handler) Remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.channels, id)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	e, status, msg := h.parse(r)
+	if status != http.StatusOK {
+		http.Error(w, msg, status)
+		return
+	}
+	f, dup := h.start(e)
+	if dup {
+		// Already handled, or being handled.
+		return
+	}
+	var err error
+	if f != nil {
+		err = f(e)
+	}
+	h.finish(e, err == nil)
+	if err != nil {
+		h.logf("channel: handling message %d on channel %s: %v", e.MessageNumber, e.ChannelID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// parse returns the event of a notification request. If the request is not
+// a valid notification for a channel of h, it returns the status and message
+// to reply with.
+func (h *Handler) parse(r *http.Request) (e *Event, status int, msg string) {
+	hdr := r.Header
+	e = &Event{
+		ChannelID:     hdr.Get("X-Goog-Channel-ID"),
+		ResourceState: ResourceState(hdr.Get("X-Goog-Resource-State")),
+		ResourceID:    hdr.Get("X-Goog-Resource-ID"),
+		ResourceURI:   hdr.Get("X-Goog-Resource-URI"),
+		Header:        hdr,
+	}
+	if e.ChannelID == "" || e.ResourceState == "" {
+		return nil, http.StatusBadRequest, "not a push notification"
+	}
+	n, err := strconv.ParseInt(hdr.Get("X-Goog-Message-Number"), 10, 64)
+	if err != nil || n < 1 {
+		return nil, http.StatusBadRequest, "bad message number"
+	}
+	e.MessageNumber = n
+	if s := hdr.Get("X-Goog-Channel-Expiration"); s != "" {
+		t, err := http.ParseTime(s)
+		if err != nil {
+			return nil, http.StatusBadRequest, "bad channel expiration"
+		}
+		e.Expiration = t
+	}
+	if s := hdr.Get("X-Goog-Changed"); s != "" {
+		for _, c := range strings.Split(s, ",") {
+			e.Changed = append(e.Changed, strings.TrimSpace(c))
+		}
+	}
+
+	h.mu.Lock()
+	cs, ok := h.channels[e.ChannelID]
+	var ch Channel
+	if ok {
+		ch = *cs.ch
+	}
+	h.mu.Unlock()
+	if !ok {
+		return nil, http.StatusNotFound, "unknown channel"
+	}
+	token := hdr.Get("X-Goog-Channel-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ch.Token)) != 1 {
+		return nil, http.StatusForbidden, "bad channel token"
+	}
+	if ch.ResourceID != "" && e.ResourceID != ch.ResourceID {
+		return nil, http.StatusForbidden, "wrong resource for channel"
+	}
+	now := h.now()
+	if !ch.Expiration.IsZero() && now.After(ch.Expiration) ||
+		!e.Expiration.IsZero() && now.After(e.Expiration) {
+		return nil, http.StatusForbidden, "channel expired"
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, "reading body failed"
+	}
+	if len(body) > maxBodySize {
+		return nil, http.StatusRequestEntityTooLarge, "body too large"
+	}
+	if len(body) > 0 {
+		e.Body = body
+	}
+	return e, http.StatusOK, ""
+}
+
+// start marks e as being handled and returns the HandlerFunc for it. It
+// reports whether e is a duplicate, in which case it must not be handled.
+func (h *Handler) start(e *Event) (f HandlerFunc, dup bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cs, ok := h.channels[e.ChannelID]
+	if !ok {
+		// Removed since the request was parsed.
+		return nil, true
+	}
+	n := e.MessageNumber
+	if cs.seen[n] || cs.pending[n] || n <= cs.max-dedupWindow {
+		return nil, true
+	}
+	cs.pending[n] = true
+	f, ok = h.handlers[e.ResourceState]
+	if !ok {
+		f = h.handlers[""]
+	}
+	return f, false
+}
+
+// finish records that e was handled. If ok is false, e may be delivered
+// again.
+func (h *Handler) finish(e *Event, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cs, found := h.channels[e.ChannelID]
+	if !found {
+		return
+	}
+	n := e.MessageNumber
+	delete(cs.pending, n)
+	if !ok {
+		return
+	}
+	cs.seen[n] = true
+	if n > cs.max {
+		cs.max = n
+		for m := range cs.seen {
+			if m <= cs.max-dedupWindow {
+				delete(cs.seen, m)
+			}
+		}
+	}
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package channel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/googleapis/gax-go/v2"
+)
+
+// DefaultRenewBefore is how long before a channel expires a Renewer replaces
+// it, if its RenewBefore is zero.
+const DefaultRenewBefore = 10 * time.Minute
+
+// stopTimeout bounds the Stop call made for the last channel when Run returns.
+const stopTimeout = 30 * time.Second
+
+// A WatchFunc opens a channel with the given ID and token by calling a watch
+// method of an API, such as drive.ChangesService.Watch. It returns the
+// channel returned by the call; FromAPI converts it.
+type WatchFunc func(ctx context.Context, id, token string) (*Channel, error)
+
+// A StopFunc closes a channel by calling the Channels.Stop method of an API.
+type StopFunc func(ctx context.Context, ch *Channel) error
+
+// A Renewer keeps a channel open. It opens a channel with Watch, adds it to
+// Handler, and replaces it with a new channel before it expires. The old
+// channel is closed with Stop once the new one is in place, so that no
+// notifications are missed.
+type Renewer struct {
+	Handler *Handler
+	Watch   WatchFunc
+	Stop    StopFunc
+
+	// RenewBefore is how long before a channel expires it is replaced. The
+	// default is DefaultRenewBefore.
+	RenewBefore time.Duration
+
+	// OnError, if not nil, is called with errors that do not stop Run, such as
+	// a failed renewal that is retried or a failure to close an old channel.
+	OnError func(error)
+
+	now   func() time.Time                     // for testing
+	after func(time.Duration) <-chan time.Time // for testing
+}
+
+// Run opens a channel and renews it until ctx is done or the channel cannot
+// be renewed. A failed renewal is reported to OnError and retried with
+// backoff until the channel expires. When Run returns, the last channel is
+// closed and removed from the Handler. Run returns ctx.Err() if ctx is done,
+// and the error of the last watch call otherwise.
+func (r *Renewer) Run(ctx context.Context) error {
+	if r.Handler == nil || r.Watch == nil || r.Stop == nil {
+		return errors.New("channel: Renewer needs a Handler, Watch and Stop")
+	}
+	now, after := r.now, r.after
+	if now == nil {
+		now = time.Now
+	}
+	if after == nil {
+		after = time.After
+	}
+	before := r.RenewBefore
+	if before <= 0 {
+		before = DefaultRenewBefore
+	}
+
+	ch, err := r.open(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		if ch.Expiration.IsZero() {
+			// The channel never needs renewing.
+			<-ctx.Done()
+			r.close(ch)
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			r.close(ch)
+			return ctx.Err()
+		case <-after(ch.Expiration.Sub(now()) - before):
+		}
+		next, err := r.renew(ctx, ch, now, after)
+		if err != nil {
+			r.close(ch)
+			return err
+		}
+		r.close(ch)
+		ch = next
+	}
+}
+
+// renew opens a channel to replace ch. Failed attempts are reported to
+// OnError and retried with backoff until ch expires.
+func (r *Renewer) renew(ctx context.Context, ch *Channel, now func() time.Time, after func(time.Duration) <-chan time.Time) (*Channel, error) {
+	bo := &gax.Backoff{Initial: time.Second, Max: time.Minute}
+	for {
+		next, err := r.open(ctx)
+		if err == nil {
+			return next, nil
+		}
+		left := ch.Expiration.Sub(now())
+		if left <= 0 || ctx.Err() != nil {
+			return nil, err
+		}
+		if r.OnError != nil {
+			r.OnError(err)
+		}
+		pause := bo.Pause()
+		if pause > left {
+			pause = left
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-after(pause):
+		}
+	}
+}
+
+// open opens a new channel and adds it to the Handler.
+func (r *Renewer) open(ctx context.Context) (*Channel, error) {
+	id, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	// Add the channel before opening it, since the Sync notification can
+	// arrive before the watch call returns.
+	r.Handler.Add(&Channel{ID: id, Token: token})
+	ch, err := r.Watch(ctx, id, token)
+	if err != nil {
+		r.Handler.Remove(id)
+		return nil, err
+	}
+	if ch == nil {
+		r.Handler.Remove(id)
+		return nil, errors.New("channel: watch call returned no channel")
+	}
+	if ch.ID != id || ch.Token != "" && ch.Token != token {
+		r.Handler.Remove(id)
+		r.stop(ch)
+		return nil, errors.New("channel: watch call returned a different channel")
+	}
+	ch.Token = token
+	r.Handler.Add(ch)
+	return ch, nil
+}
+
+// close closes ch and removes it from the Handler.
+func (r *Renewer) close(ch *Channel) {
+	r.Handler.Remove(ch.ID)
+	r.stop(ch)
+}
+
+func (r *Renewer) stop(ch *Channel) {
+	// ctx may be done, so don't use it.
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	if err := r.Stop(ctx, ch); err != nil && r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+// randomString returns a random string suitable for a channel ID or token.
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package channel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI records the channels opened and closed through a Renewer.
+type fakeAPI struct {
+	mu      sync.Mutex
+	h       *Handler
+	opened  []string
+	stopped []string
+	fail    bool
+}
+
+func (f *fakeAPI) watch(ctx context.Context, id, token string) (*Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, errors.New("watch failed")
+	}
+	// The sync notification arrives before the watch call returns.
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Goog-Channel-ID", id)
+	req.Header.Set("X-Goog-Channel-Token", token)
+	req.Header.Set("X-Goog-Message-Number", "1")
+	req.Header.Set("X-Goog-Resource-State", "sync")
+	w := httptest.NewRecorder()
+	f.h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return nil, errors.New("sync notification rejected")
+	}
+	f.opened = append(f.opened, id)
+	return &Channel{ID: id, ResourceID: "res", Expiration: testNow.Add(time.Hour)}, nil
+}
+
+func (f *fakeAPI) stop(ctx context.Context, ch *Channel) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = append(f.stopped, ch.ID)
+	return nil
+}
+
+func TestRenewer(t *testing.T) {
+	h := NewHandler()
+	h.now = func() time.Time { return testNow }
+	api := &fakeAPI{h: h}
+	waits := make(chan time.Duration)
+	timer := make(chan time.Time)
+	r := &Renewer{
+		Handler:     h,
+		Watch:       api.watch,
+		Stop:        api.stop,
+		RenewBefore: 5 * time.Minute,
+		now:         func() time.Time { return testNow },
+		after: func(d time.Duration) <-chan time.Time {
+			waits <- d
+			return timer
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+
+	for i := 0; i < 2; i++ {
+		if d := <-waits; d != 55*time.Minute {
+			t.Errorf("waiting %v to renew, want 55m", d)
+		}
+		timer <- testNow
+	}
+	<-waits
+	api.mu.Lock()
+	opened, stopped := api.opened, api.stopped
+	api.mu.Unlock()
+	if len(opened) != 3 || len(stopped) != 2 || stopped[0] != opened[0] || stopped[1] != opened[1] {
+		t.Fatalf("opened %q and stopped %q", opened, stopped)
+	}
+	h.mu.Lock()
+	_, ok := h.channels[opened[2]]
+	n := len(h.channels)
+	h.mu.Unlock()
+	if !ok || n != 1 {
+		t.Errorf("handler has %d channels, want only the last one", n)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v, want context.Canceled", err)
+	}
+	if len(api.stopped) != 3 || api.stopped[2] != opened[2] {
+		t.Errorf("stopped %q, want the last channel stopped too", api.stopped)
+	}
+	if len(h.channels) != 0 {
+		t.Errorf("handler has %d channels after Run, want 0", len(h.channels))
+	}
+}
+
+func TestRenewerWatchFails(t *testing.T) {
+	h := NewHandler()
+	api := &fakeAPI{h: h, fail: true}
+	r := &Renewer{Handler: h, Watch: api.watch, Stop: api.stop}
+	if err := r.Run(context.Background()); err == nil || err.Error() != "watch failed" {
+		t.Errorf("got %v, want the watch error", err)
+	}
+	if len(h.channels) != 0 {
+		t.Errorf("handler has %d channels, want 0", len(h.channels))
+	}
+	nilWatch := func(ctx context.Context, id, token string) (*Channel, error) { return nil, nil }
+	r = &Renewer{Handler: h, Watch: nilWatch, Stop: api.stop}
+	if err := r.Run(context.Background()); err == nil {
+		t.Error("Run with a watch call returning no channel: got nil, want error")
+	}
+	if len(h.channels) != 0 {
+		t.Errorf("handler has %d channels after a watch call returned no channel, want 0", len(h.channels))
+	}
+	if err := (&Renewer{Handler: h}).Run(context.Background()); err == nil {
+		t.Error("Run without Watch and Stop: got nil, want error")
+	}
+}
+
+func TestRenewerRetriesRenewal(t *testing.T) {
+	for _, recovers := range []bool{true, false} {
+		h := NewHandler()
+		clock := testNow
+		h.now = func() time.Time { return clock }
+		api := &fakeAPI{h: h}
+		ctx, cancel := context.WithCancel(context.Background())
+		var errs, waits int
+		r := &Renewer{
+			Handler: h,
+			Watch:   api.watch,
+			Stop:    api.stop,
+			OnError: func(error) { errs++ },
+			now:     func() time.Time { return clock },
+			after: func(d time.Duration) <-chan time.Time {
+				waits++
+				api.mu.Lock()
+				defer api.mu.Unlock()
+				switch {
+				case waits == 1:
+					// Renewals fail from now on.
+					api.fail = true
+				case waits == 3 && recovers:
+					api.fail = false
+				case !api.fail:
+					// The channel was renewed.
+					cancel()
+					return nil
+				}
+				clock = clock.Add(d)
+				c := make(chan time.Time, 1)
+				c <- clock
+				return c
+			},
+		}
+		err := r.Run(ctx)
+		cancel()
+		if recovers {
+			if err != context.Canceled {
+				t.Errorf("recovered: Run returned %v, want context.Canceled", err)
+			}
+			if errs != 2 || len(api.opened) != 2 {
+				t.Errorf("recovered: got %d errors and %d channels opened, want 2 and 2", errs, len(api.opened))
+			}
+			continue
+		}
+		if err == nil || err.Error() != "watch failed" {
+			t.Errorf("failed: Run returned %v, want the watch error", err)
+		}
+		if errs == 0 {
+			t.Error("failed: no errors reported")
+		}
+		if exp := testNow.Add(time.Hour); clock.Before(exp) {
+			t.Errorf("failed: gave up at %v, before the channel expired at %v", clock, exp)
+		}
+		if len(api.stopped) != 1 || len(h.channels) != 0 {
+			t.Errorf("failed: stopped %q and left %d channels in the handler", api.stopped, len(h.channels))
+		}
+	}
+}